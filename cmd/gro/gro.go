@@ -20,11 +20,12 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/grolang/gro/lsp"
 	"github.com/grolang/gro/sys"
 )
 
 const (
-	versionNo = "0.8.1"
+	versionNo = sys.Version
 	progDesc  = "managing Gro scripts"
 )
 
@@ -54,8 +55,42 @@ var (
 
 func addBuildFlags(cmd *Command) {
 	cmd.Flag = *flag.NewFlagSet("", flag.ContinueOnError) // needs to be reset each time for test suite
+	sys.OutDir, sys.Parallel = "", 0                      // as are the options not set by this command's flags
+	sys.DryRun, sys.ShowDiff, sys.CheckStale, sys.Force = false, false, false, false
+	sys.Hermetic, sys.Keep = false, false
+	sys.Timeout, sys.RunTests, sys.StdinName = 0, "", ""
 	cmd.Flag.BoolVar(&sys.WantMsgs, "v", false, "print steps as they are executed")
 	cmd.Flag.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to this file")
+	sys.JSON, sys.HTML = false, false
+	if cmd == cmdPrepare || cmd == cmdCheck || cmd == cmdExecute {
+		cmd.Flag.BoolVar(&sys.JSON, "json", false, "print errors as JSON")
+	}
+	if cmd == cmdPrepare || cmd == cmdExecute || cmd == cmdTest {
+		cmd.Flag.StringVar(&sys.OutDir, "o", "", "generate the go files into this directory")
+		cmd.Flag.IntVar(&sys.Parallel, "p", runtime.GOMAXPROCS(0), "number of gro files to prepare in parallel")
+		cmd.Flag.BoolVar(&sys.Force, "a", false, "prepare gro files even if they're up to date")
+	}
+	if cmd == cmdExecute || cmd == cmdRun || cmd == cmdRepl {
+		cmd.Flag.DurationVar(&sys.Timeout, "timeout", 0, "stop the program if it runs for longer than this")
+	}
+	if cmd == cmdExecute {
+		cmd.Flag.BoolVar(&sys.Hermetic, "hermetic", false, "prepare and build in a temporary workspace")
+		cmd.Flag.BoolVar(&sys.Keep, "keep", false, "prepare and build in a workspace, and keep it")
+	}
+	if cmd == cmdTest {
+		cmd.Flag.StringVar(&sys.RunTests, "run", "", "run only the tests matching this regular expression")
+	}
+	if cmd == cmdPrepare || cmd == cmdClean {
+		cmd.Flag.BoolVar(&sys.DryRun, "n", false, "print the names of the go files instead of writing or removing them")
+	}
+	if cmd == cmdDoc {
+		cmd.Flag.BoolVar(&sys.HTML, "html", false, "print an HTML page rather than text")
+	}
+	if cmd == cmdPrepare {
+		cmd.Flag.StringVar(&sys.StdinName, "name", "", "name of the gro file on the standard input")
+		cmd.Flag.BoolVar(&sys.ShowDiff, "d", false, "print diffs against the go files instead of writing them")
+		cmd.Flag.BoolVar(&sys.CheckStale, "check", false, "report go files that are stale instead of writing them")
+	}
 }
 
 //================================================================================
@@ -138,6 +173,23 @@ func version(args ...string) {
 		versionNo, runtime.Version(), runtime.GOOS, runtime.GOARCH)
 }
 
+//--------------------------------------------------------------------------------
+func serveLsp(args ...string) {
+	if len(args) != 0 {
+		fmt.Fprintf(sys.Stderr, "%s: usage: gro lsp\nToo many arguments given.\n", sys.ProgName)
+		setExitStatus(2)
+		return
+	}
+	var msgs io.Writer
+	if sys.WantMsgs {
+		msgs = sys.Stderr
+	}
+	if err := lsp.Serve(sys.Stdin, sys.Stdout, msgs); err != nil {
+		fmt.Fprintf(sys.Stderr, "%s: lsp: %s\n", sys.ProgName, err)
+		setExitStatus(1)
+	}
+}
+
 //================================================================================
 
 // A Command is an implementation of a gro command
@@ -194,9 +246,20 @@ func (c *Command) Runnable() bool {
 var Commands = []*Command{
 	cmdPrepare,
 	cmdExecute,
+	cmdRun,
+	cmdTest,
+	cmdFmt,
+	cmdCheck,
+	cmdClean,
+	cmdDoc,
+	cmdRepl,
+	cmdLsp,
+	cmdCache,
+	cmdProfiles,
 	cmdVersion,
 
 	helpFlags,
+	helpConfig,
 }
 
 //--------------------------------------------------------------------------------
@@ -208,10 +271,50 @@ var cmdPrepare = &Command{
 Prepare generates formatted Go programs from Gro scripts.
 It uses the same whitespace as gofmt.
 
-Without an explicit path, it processes the standard input and prints the reformatted source to the standard output.
 Given a file, it operates on that file; given a directory, it operates on all .gro files in that directory, recursively.
 (Files starting with a period are ignored.)
 It then prints the generated Go source to the output files as determined by the Gro source.
+Each go file starts with a "// Code generated by gro from X.gro; DO NOT EDIT." comment.
+
+Without an explicit path, it processes the standard input and prints the generated Go source to the standard output.
+When more than one go file is generated, they are printed as a txtar archive, each after a "-- name --" line.
+No manifest is written.
+
+	-name file
+		Prepare the standard input as if it were the named Gro script, such as an unsaved one.
+		The default is stdin.gro in the current directory.
+
+The output files go under the directory of each Gro script, or the directory given by the -o flag.
+Their import paths come from the nearest go.mod file at or above that directory, being the module path
+followed by the directory's path within the module. Outside any module, they are the directory's path
+within the src directory of the GOPATH entry holding it, if there is one.
+
+Prepare records the Gro scripts, the extra files they include, and the go files generated,
+with the hash of each, in a .gro-manifest.json file in the directory the go files are generated into.
+A Gro script is then only prepared again if one of those files has changed since.
+
+	-a
+		Prepare the Gro scripts even if they are up to date.
+	-json
+		Print each error as a JSON object on a line of its own, with the fields file, line, column,
+		endLine, endColumn, severity, code and message. The code is the permit disabled, such as useKw,
+		for errors caused by one.
+	-o dir
+		Generate the go files into the directory, instead of that of the Gro script.
+	-p n
+		Parse up to n Gro scripts at the same time. The default is the number of CPUs available.
+		The go files are written, and errors reported, in the order of the Gro scripts' paths, whatever n is,
+		and it is an error for two Gro scripts to generate the same go file.
+
+The following flags stop the go files being written, and can be combined.
+All Gro scripts are then prepared, and no manifest is written.
+
+	-n
+		Print the names of the go files that would be written.
+	-d
+		Print a unified diff between each go file that would be written and the one on disk.
+	-check
+		Report each go file on disk that differs from what would be written, exiting with status 1 if any do.
 
 `,
 }
@@ -219,16 +322,234 @@ It then prints the generated Go source to the output files as determined by the
 //--------------------------------------------------------------------------------
 var cmdExecute = &Command{
 	Run:       sys.Execute,
-	UsageLine: "execute [flags] [path ...]",
+	UsageLine: "execute [flags] path [-- arg ...]",
 	Short:     "generate the go files then run the main func",
 	Long: `
-Execute first prepares the Gro scripts, then runs package main function main()
-on the go file with the same name as the first gro file.
+Execute first prepares the Gro script, then runs the go file with the same name as gro run does.
+The -a, -json, -o and -p flags are as for prepare, and the -timeout flag as for run.
+See gro help prepare and gro help run.
+
+The program built is cached, keyed on the Gro script, its path, the directory the go files
+are generated into, and the Gro and Go versions. While the Gro script and the extra files it includes
+are unchanged, execute runs the cached program directly, without preparing or building it again.
+The -a flag prepares and builds it anyway. See gro help cache.
+
+	-hermetic
+		Prepare the Gro script into a temporary workspace with its own go.mod, instead of beside it,
+		then build and run it from there, and remove the workspace. Nothing is written to the source tree,
+		so scripts in read-only or shared directories can be run. The program still runs in the current
+		directory. Any modules the go files import are added to the go.mod when building.
+	-keep
+		As -hermetic, but keep the workspace afterwards and print where it is, for inspection.
+		The cached program is not used.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdRun = &Command{
+	Run:       sys.Run,
+	UsageLine: "run [flags] path [-- arg ...]",
+	Short:     "run go files already generated",
+	Long: `
+Run builds a go file, or the package in a directory, such as one already generated by prepare,
+then runs its package main function main(), passing it the args after the --.
+Gro exits with the same status as the program, or 128 plus the number of the signal that stopped it.
+Terminate signals received while the program runs are passed on to it. An interrupt from the
+terminal reaches the program directly, and gro waits for it to stop.
+
+	-timeout d
+		Interrupt the program if it runs for longer than the duration d, such as 30s,
+		killing it if it then doesn't stop within 5 seconds. The default is no limit.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdTest = &Command{
+	Run:       sys.Test,
+	UsageLine: "test [flags] path ...",
+	Short:     "test the packages generated from testcode sections",
+	Long: `
+Test prepares the Gro scripts, then runs go test on exactly those packages
+that testcode sections in them were prepared into.
+Given a file, it prepares that file; given a directory holding .gro files, it prepares them all, recursively.
+Any other path, such as that of a Go package, is passed to go test as it is.
+Gro exits with the same status as go test.
+
+	-run regexp
+		Run only the tests matching the regular expression, as for go test.
+	-v
+		Print the steps as they are executed, and pass the -v flag to go test.
+
+The -a, -o and -p flags are as for prepare.
 See gro help prepare.
 
 `,
 }
 
+//--------------------------------------------------------------------------------
+var cmdFmt = &Command{
+	Run:       sys.Format,
+	UsageLine: "fmt [flags] [path ...]",
+	Short:     "format the gro files",
+	Long: `
+Fmt formats Gro scripts, keeping the Gro syntax as written.
+It uses the same indentation, spacing and alignment as gofmt.
+Blank lines, and the spacing around binary operators, are kept as written.
+
+Without an explicit path, it processes the standard input and prints the reformatted source to the standard output.
+Given a file, it operates on that file; given a directory, it operates on all .gro, .grog, .groo and .grooy files
+in that directory, recursively. (Files starting with a period are ignored.)
+Files are rewritten in place, and only if formatting changes them.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdCheck = &Command{
+	Run:       sys.Check,
+	UsageLine: "check [flags] [path ...]",
+	Short:     "report errors in the gro files",
+	Long: `
+Check parses Gro scripts and reports every syntax and permit error found, not just the first one.
+It writes no files.
+
+Without an explicit path, it checks the current directory.
+Given a file, it operates on that file; given a directory, it operates on all .gro, .grog, .groo and .grooy files
+in that directory, recursively. (Files starting with a period are ignored.)
+It exits with status 1 if any errors are found.
+
+	-json
+		Print each error as a JSON object on a line of its own, with the fields file, line, column,
+		endLine, endColumn, severity, code and message. The code is the permit disabled, such as useKw,
+		for errors caused by one.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdClean = &Command{
+	Run:       sys.Clean,
+	UsageLine: "clean [flags] [dir ...]",
+	Short:     "remove the go files generated",
+	Long: `
+Clean removes the go files recorded in the .gro-manifest.json files written by prepare,
+then the manifests themselves. It removes nothing else.
+
+Without an explicit directory, it cleans the current directory.
+Given a directory, it cleans each manifest in that directory, recursively.
+A go file that has changed since it was generated is reported and kept, and clean then exits with status 1.
+
+	-n
+		Print the names of the go files that would be removed.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdDoc = &Command{
+	Run:       sys.Doc,
+	UsageLine: "doc [flags] path ...",
+	Short:     "print the documentation of gro files",
+	Long: `
+Doc prints the documentation of Gro scripts, keeping the structure of each project.
+
+For each file, it prints the project name and doc comment, then each package with its generic
+parameters, its import path and its doc comment, then the exported declarations in each section
+of the package, each with its doc comment. Declarations in a group share the doc comment of the group.
+Testcode sections are left out.
+
+	-html
+		Print an HTML page instead of text.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdRepl = &Command{
+	Run:       sys.Repl,
+	UsageLine: "repl [flags]",
+	Short:     "run groo entries interactively",
+	Long: `
+Repl reads groo statements, expressions and declarations from the standard input, one entry at a time,
+and runs each. The value of an expression is printed, using the String methods of the dynamic types.
+An entry continues over several lines while it leaves brackets open. Enter :quit, or end the input, to stop.
+
+Each entry is run along with the declarations entered before it, and the variables bound by earlier
+entries keep the values they were left with, so no statement is run twice, big numbers included.
+A variable whose value can't be carried over, such as a pointer, is dropped with a note.
+Entries that fail are dropped. A function call is run as a statement, without printing what it returns.
+
+	-timeout duration
+		Stop each entry if it runs for longer than this, e.g. 10s.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdLsp = &Command{
+	Run:       serveLsp,
+	UsageLine: "lsp [flags]",
+	Short:     "run the language server",
+	Long: `
+Lsp runs a Language Server Protocol server for Gro scripts, for editors to start.
+It speaks JSON-RPC on the standard input and output, and exits when the editor asks it to.
+
+It reports the errors in each file open in the editor as it changes, as check does.
+It finds where a name is declared in any package or section of a file.
+Its hover text is the Go code the statement or declaration at the line hovered over is generated as,
+such as the function call an assert macro becomes, or the calls the operators of a .groo file become.
+It formats files as fmt does.
+
+With -v, it prints the method of each message received to the standard error.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdCache = &Command{
+	Run:       sys.Cache,
+	UsageLine: "cache [flags] list|clean|dir",
+	Short:     "manage the programs cached by execute",
+	Long: `
+Cache manages the programs execute builds and caches.
+
+	list
+		Print when each cached program was last used, its size, and the Gro script it was built from,
+		most recently used first.
+	clean
+		Remove all the cached programs.
+	dir
+		Print the cache directory.
+
+The cache directory is the gro directory in the user's cache directory, such as ~/.cache/gro on Linux.
+The GROCACHE environment variable sets another directory, or if it is off, turns caching off.
+
+`,
+}
+
+//--------------------------------------------------------------------------------
+var cmdProfiles = &Command{
+	Run:       sys.Profiles,
+	UsageLine: "profiles [flags] [path ...]",
+	Short:     "list the profiles and their permits",
+	Long: `
+Profiles lists the profiles of Gro, from the lowest level up, each with the permits it adds
+over the one before, and their descriptions. The extension of a Gro script chooses its profile,
+such as .g0150 or .grog, and it has the permits of that profile and all those before it.
+Permits marked as not yet checked are not yet enforced by the parser, so have no effect when disabled.
+
+Given Gro scripts, it instead lists the permits in effect in each, with the profile that adds each one.
+Those disabled by use "blacklist"(...), or left out of a use "whitelist"(...), are marked as disabled.
+Errors found in a Gro script, such as its use of a disabled permit, are reported, and its permits still listed.
+
+User profiles, building on the built-in ones, can be defined in the files given by a gro.cfg file.
+See gro help config. A Gro script can also choose its profile with use "profile"("name").
+
+`,
+}
+
 //--------------------------------------------------------------------------------
 var cmdVersion = &Command{
 	Run:       version,
@@ -245,7 +566,7 @@ var helpFlags = &Command{
 	UsageLine: "flags",
 	Short:     "flags used in Gro",
 	Long: `
-The flags common to both prepare and execute are:
+The flags common to all the commands are:
 
 	-cpuprofile filename
 		Write cpu profile to the specified file.
@@ -255,6 +576,57 @@ The flags common to both prepare and execute are:
 `,
 }
 
+//--------------------------------------------------------------------------------
+var helpConfig = &Command{
+	UsageLine: "config",
+	Short:     "the gro.cfg configuration file",
+	Long: `
+A gro.cfg file configures the Gro scripts in its directory and those below it, as far down as the next one.
+The nearest one at or above the directory of each Gro script applies to it.
+
+Each line of the file gives a keyword followed by any arguments, which can be quoted.
+Comments start with //.
+
+	profile name
+		The profile of .gro files, such as g0450 or grog, instead of gro. See gro help profiles.
+	blacklist permit ...
+		Disable the permits in every Gro script, as if each began with use "blacklist"(...).
+		Can be given more than once.
+	output dir
+		Generate the go files into the directory, relative to that of the gro.cfg file.
+		The -o flag overrides it.
+	linedirectives on|off
+		Whether the go files have //line directives pointing back to the Gro scripts.
+	use name [arg ...]
+		Apply the use declaration to every Gro script, as if each began with use "name"("arg", ...).
+		Can be given more than once.
+	profiles file ...
+		Define the user profiles in the files, relative to the directory of the gro.cfg file.
+		Can be given more than once.
+
+A file of user profiles starts each profile with a line naming it, and the profile it builds on if any,
+which can be built in or defined before it. The lines after it describe it:
+
+	profile basics g0070
+		A profile named basics, chosen by the .basics extension, building on g0070.
+	alias ext ...
+		Other extensions choosing it.
+	desc text
+		Its description.
+	add permit ...
+	remove permit ...
+		The permits it adds, and those of the profile it builds on it takes away.
+	use name [arg ...]
+		A use declaration in effect at the top of every Gro script with the profile.
+	dynamic
+	hashcmds
+		Dynamic typing, as in .groo files, or hash-cmds as well, as in .grooy files.
+
+A Gro script is prepared again when the gro.cfg file applying to it changes.
+
+`,
+}
+
 // ============================================================================
 // An errWriter wraps a writer, recording whether a write error occurred.
 type errWriter struct {
@@ -7,6 +7,10 @@ package main_test
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/grolang/gro/cmd/gro"
@@ -24,6 +28,16 @@ The commands are:
 
 	prepare     generate the go files
 	execute     generate the go files then run the main func
+	run         run go files already generated
+	test        test the packages generated from testcode sections
+	fmt         format the gro files
+	check       report errors in the gro files
+	clean       remove the go files generated
+	doc         print the documentation of gro files
+	repl        run groo entries interactively
+	lsp         run the language server
+	cache       manage the programs cached by execute
+	profiles    list the profiles and their permits
 	version     print Gro version
 
 Use "gro help [command]" for more information about a command.
@@ -31,15 +45,56 @@ Use "gro help [command]" for more information about a command.
 Additional help topics:
 
 	flags       flags used in Gro
+	config      the gro.cfg configuration file
 
 Use "gro help [topic]" for more information about that topic.
 
 `
 
+const sayhiGo = `// Code generated by gro from sayhi.gro; DO NOT EDIT.
+
+// +build ignore
+
+package main
+
+import (
+	fmt "fmt"
+)
+
+func init() {
+	fmt.Println("Hello, world!")
+}
+
+func main() {}
+`
+
+// removeGenerated removes the files the tests write under dir that aren't kept
+// there, being the manifests written by prepare, and the go files of the Gro
+// scripts only executed.
+func removeGenerated(dir string) {
+	filepath.Walk(dir, func(pth string, f os.FileInfo, err error) error {
+		if err == nil && f.Name() == sys.ManifestName {
+			os.Remove(pth)
+		}
+		return nil
+	})
+	for _, name := range []string{"exitcode.go", "sleep.go"} {
+		os.Remove(filepath.Join(dir, name))
+	}
+}
+
 func TestMain(t *testing.T) {
 	var fn string
 	var u, w *bytes.Buffer
 
+	cache, err := ioutil.TempDir("", "gro-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	os.Setenv(sys.CacheEnv, cache)
+	defer removeGenerated("testdata")
+
 	//--------------------------------------------------------------------------------
 	//calling Gro without any args
 	w = new(bytes.Buffer)
@@ -66,10 +121,50 @@ usage: gro prepare [flags] [path ...]
 Prepare generates formatted Go programs from Gro scripts.
 It uses the same whitespace as gofmt.
 
-Without an explicit path, it processes the standard input and prints the reformatted source to the standard output.
 Given a file, it operates on that file; given a directory, it operates on all .gro files in that directory, recursively.
 (Files starting with a period are ignored.)
 It then prints the generated Go source to the output files as determined by the Gro source.
+Each go file starts with a "// Code generated by gro from X.gro; DO NOT EDIT." comment.
+
+Without an explicit path, it processes the standard input and prints the generated Go source to the standard output.
+When more than one go file is generated, they are printed as a txtar archive, each after a "-- name --" line.
+No manifest is written.
+
+	-name file
+		Prepare the standard input as if it were the named Gro script, such as an unsaved one.
+		The default is stdin.gro in the current directory.
+
+The output files go under the directory of each Gro script, or the directory given by the -o flag.
+Their import paths come from the nearest go.mod file at or above that directory, being the module path
+followed by the directory's path within the module. Outside any module, they are the directory's path
+within the src directory of the GOPATH entry holding it, if there is one.
+
+Prepare records the Gro scripts, the extra files they include, and the go files generated,
+with the hash of each, in a .gro-manifest.json file in the directory the go files are generated into.
+A Gro script is then only prepared again if one of those files has changed since.
+
+	-a
+		Prepare the Gro scripts even if they are up to date.
+	-json
+		Print each error as a JSON object on a line of its own, with the fields file, line, column,
+		endLine, endColumn, severity, code and message. The code is the permit disabled, such as useKw,
+		for errors caused by one.
+	-o dir
+		Generate the go files into the directory, instead of that of the Gro script.
+	-p n
+		Parse up to n Gro scripts at the same time. The default is the number of CPUs available.
+		The go files are written in the order the Gro scripts are given, whatever n is,
+		and it is an error for two Gro scripts to generate the same go file.
+
+The following flags stop the go files being written, and can be combined.
+All Gro scripts are then prepared, and no manifest is written.
+
+	-n
+		Print the names of the go files that would be written.
+	-d
+		Print a unified diff between each go file that would be written and the one on disk.
+	-check
+		Report each go file on disk that differs from what would be written, exiting with status 1 if any do.
 
 `
 	w = new(bytes.Buffer)
@@ -108,13 +203,63 @@ It then prints the generated Go source to the output files as determined by the
 	}
 
 	//--------------------------------------------------------------------------------
-	//calling 'gro prepare' i.e. not enough args
+	//calling 'gro lsp extra_arg'
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"lsp", "extra_arg"})
+	if fmt.Sprintf("%s", w) != "gro: usage: gro lsp\nToo many arguments given.\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stderr for lsp with superfluous args:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro lsp' with the standard input ending before shutdown
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	sys.Stdin = strings.NewReader("Content-Length: 46\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	main.Main([]string{"lsp"})
+	if fmt.Sprintf("%s", w) != "gro: lsp: input ended without shutdown\n" || sys.ExitStatus != 1 ||
+		!strings.Contains(u.String(), `"id":1,"result":{"capabilities":`) {
+		t.Errorf("wrong text received for lsp ending before shutdown:\n%s\n%s\n", w, u)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare' on the standard input
+	stdin, err := os.Open("testdata/sayhi.gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	sys.Stdin = stdin
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"prepare", "-name", "testdata/sayhi.gro"})
+	if fmt.Sprintf("%s", u) != sayhiGo {
+		t.Errorf("wrong text received from Stdout for prepare with standard input:\n%s\n", u)
+	}
+	if fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stderr for prepare with standard input:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare' on the standard input, generating more than one go file
+	sys.Stdin = strings.NewReader("package abc\nfunc Hi() {}\ntestcode \"abc\"\nfunc TestHi() {}\n")
+	u = new(bytes.Buffer)
+	sys.Stdout = u
 	w = new(bytes.Buffer)
 	sys.Stderr = w
 	main.Main([]string{"prepare"})
-	if fmt.Sprintf("%s", w) != "gro: usage: gro prepare path\n"+
-		"Not enough arguments given.\n" {
-		t.Errorf("wrong text received from Stderr for prepare with no args:\n%s\n", w)
+	if fmt.Sprintf("%s", u) != "-- abc_test.go --\n"+
+		"// Code generated by gro from stdin.gro; DO NOT EDIT.\n\npackage abc\n\nfunc TestHi() {}\n"+
+		"-- stdin.go --\n"+
+		"// Code generated by gro from stdin.gro; DO NOT EDIT.\n\npackage abc\n\nfunc Hi() {}\n" {
+		t.Errorf("wrong text received from Stdout for prepare with standard input:\n%s\n", u)
+	}
+	if fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stderr for prepare with standard input:\n%s\n", w)
 	}
 
 	//--------------------------------------------------------------------------------
@@ -128,13 +273,12 @@ It then prints the generated Go source to the output files as determined by the
 	}
 
 	//--------------------------------------------------------------------------------
-	//calling 'gro prepare somefile.gro' with message flag
+	//calling 'gro prepare somefile.gro' with message flag, the file being up to date
 	w = new(bytes.Buffer)
 	sys.Stderr = w
 	fn = "testdata/sayhi.gro" // we don't put "src/github.com/grolang/gro/cmd/gro/" in front
 	main.Main([]string{"prepare", "-v", fn})
-	if fmt.Sprintf("%s", w) != "gro: preparing testdata/sayhi.gro\n"+
-		"gro: Received 1 files from ParsePackage.\n" {
+	if fmt.Sprintf("%s", w) != "gro: testdata/sayhi.gro is up to date\n" {
 		t.Errorf("wrong text received from Stderr for prepare with file %s as arg:\n%s\n", fn, w)
 	}
 
@@ -149,15 +293,13 @@ It then prints the generated Go source to the output files as determined by the
 	}
 
 	//--------------------------------------------------------------------------------
-	//calling 'gro prepare somedir' with message flag
+	//calling 'gro prepare somedir' with message flag, the files being up to date
 	w = new(bytes.Buffer)
 	sys.Stderr = w
 	fn = "testdata/grodir"
 	main.Main([]string{"prepare", "-v", fn})
-	if fmt.Sprintf("%s", w) != "gro: preparing testdata/grodir/saycat.gro\n"+
-		"gro: Received 1 files from ParsePackage.\n"+
-		"gro: preparing testdata/grodir/saydog.gro\n"+
-		"gro: Received 1 files from ParsePackage.\n" {
+	if fmt.Sprintf("%s", w) != "gro: testdata/grodir/saycat.gro is up to date\n"+
+		"gro: testdata/grodir/saydog.gro is up to date\n" {
 		t.Errorf("wrong text received from Stderr for prepare with file %s as arg:\n%s\n", fn, w)
 	}
 
@@ -171,10 +313,10 @@ It then prints the generated Go source to the output files as determined by the
 	}
 
 	//--------------------------------------------------------------------------------
-	//calling 'gro prepare firstfile.gro secondfile.gro' with message flag
+	//calling 'gro prepare firstfile.gro secondfile.gro' with message flag, forcing them to be prepared
 	w = new(bytes.Buffer)
 	sys.Stderr = w
-	main.Main([]string{"prepare", "-v", "testdata/sayhi.gro", "testdata/saybye.gro"})
+	main.Main([]string{"prepare", "-a", "-v", "testdata/sayhi.gro", "testdata/saybye.gro"})
 	if fmt.Sprintf("%s", w) != "gro: preparing testdata/sayhi.gro\n"+
 		"gro: Received 1 files from ParsePackage.\n"+
 		"gro: preparing testdata/saybye.gro\n"+
@@ -192,12 +334,204 @@ It then prints the generated Go source to the output files as determined by the
 		t.Errorf("wrong text received from Stderr for prepare with file %s as arg:\n%s\n", fn, w)
 	}
 
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -o somedir somefile.gro'
+	out, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/sayhi.gro"
+	main.Main([]string{"prepare", "-o", out, fn})
+	if fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stderr for prepare with output directory %s:\n%s\n", out, w)
+	}
+	if _, err := os.Stat(filepath.Join(out, "sayhi.go")); err != nil {
+		t.Errorf("prepare with output directory %s: %s\n", out, err)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -o somedir firstfile.gro secondfile.gro' with both including the same file
+	shared, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(shared)
+	for i := 0; i < 2; i++ {
+		w = new(bytes.Buffer)
+		sys.Stderr = w
+		main.Main([]string{"prepare", "-o", shared, "testdata/shared/one.gro", "testdata/shared/two.gro"})
+		if fmt.Sprintf("%s", w) != "" || sys.ExitStatus != 0 {
+			t.Errorf("wrong text received from Stderr for prepare with files including the same file:\n%s\n", w)
+		}
+	}
+	for _, name := range []string{"one/one.go", "two/two.go", "lib/lib.go"} {
+		if _, err := os.Stat(filepath.Join(shared, name)); err != nil {
+			t.Errorf("prepare with files including the same file: %s\n", err)
+		}
+	}
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"prepare", "-v", "-o", shared, "testdata/shared/one.gro", "testdata/shared/two.gro"})
+	if fmt.Sprintf("%s", w) != "gro: testdata/shared/one.gro is up to date\n"+
+		"gro: testdata/shared/two.gro is up to date\n" {
+		t.Errorf("wrong text received from Stderr for prepare with files including the same file:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -n somedir' i.e. dry run
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/grodir"
+	main.Main([]string{"prepare", "-n", fn})
+	if fmt.Sprintf("%s", u) != "testdata/grodir/saycat.go\ntestdata/grodir/saydog.go\n" || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for dry run of prepare with file %s as arg:\n%s\n", fn, u)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -check somefile.gro' with the go file up to date
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/sayhi.gro"
+	main.Main([]string{"prepare", "-check", "-o", out, fn})
+	if fmt.Sprintf("%s", w) != "" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received from Stderr for staleness check with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -d -check somefile.gro' with the go file stale
+	gofn := filepath.Join(out, "sayhi.go")
+	if err := ioutil.WriteFile(gofn, []byte(strings.Replace(sayhiGo, "world", "there", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"prepare", "-d", "-check", "-o", out, fn})
+	shown := filepath.ToSlash(gofn)
+	if fmt.Sprintf("%s", u) != "--- "+shown+"\t(on disk)\n+++ "+shown+"\t(generated)\n"+
+		"@@ -9,7 +9,7 @@\n )\n \n func init() {\n-\tfmt.Println(\"Hello, there!\")\n+\tfmt.Println(\"Hello, world!\")\n }\n \n func main() {}\n" {
+		t.Errorf("wrong text received from Stdout for diff with file %s as arg:\n%s\n", fn, u)
+	}
+	if fmt.Sprintf("%s", w) != "gro: "+shown+" is stale\n" || sys.ExitStatus != 1 {
+		t.Errorf("wrong text received from Stderr for staleness check with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro fmt somedir' on already formatted files
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/grodir"
+	main.Main([]string{"fmt", fn})
+	if fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stderr for fmt with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro fmt somedir' with message flag
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/grodir"
+	main.Main([]string{"fmt", "-v", fn})
+	if fmt.Sprintf("%s", w) != "gro: formatting testdata/grodir/saycat.gro\n"+
+		"gro: formatting testdata/grodir/saydog.gro\n" {
+		t.Errorf("wrong text received from Stderr for fmt with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro fmt' on the standard input
+	sys.Stdin = strings.NewReader("project cool\ndo{\n\"fmt\".Println(1+2,[]int{3})\n}\n")
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"fmt"})
+	if fmt.Sprintf("%s", u) != "project cool\ndo {\n\t\"fmt\".Println(1+2, []int{3})\n}\n" {
+		t.Errorf("wrong text received from Stdout for fmt with standard input:\n%s\n", u)
+	}
+	if fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stderr for fmt with standard input:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro check somedir' on files without errors
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/grodir"
+	main.Main([]string{"check", fn})
+	if fmt.Sprintf("%s", w) != "" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received from Stderr for check with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro check somedir' on files with errors, all of which are reported
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/checkdir"
+	main.Main([]string{"check", fn})
+	if fmt.Sprintf("%s", w) != "testdata/checkdir/blacklisted.gro:4:1: syntax error: if-statement has been disabled but is present\n"+
+		"testdata/checkdir/blacklisted.gro:7:1: syntax error: if-statement has been disabled but is present\n"+
+		"testdata/checkdir/broken.gro:4:17: syntax error: unexpected newline, expecting comma or )\n"+
+		"testdata/checkdir/broken.gro:7:6: syntax error: unexpected =, expecting name\n"+
+		"testdata/checkdir/broken.gro:7:9: syntax error: unexpected newline, expecting type\n"+
+		"gro: 5 error(s) found\n" || sys.ExitStatus != 1 {
+		t.Errorf("wrong text received from Stderr for check with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro check -json somedir' on files with errors
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/checkdir"
+	main.Main([]string{"check", "-json", fn})
+	if fmt.Sprintf("%s", w) != `{"file":"testdata/checkdir/blacklisted.gro","line":4,"column":1,"endLine":4,"endColumn":3,`+
+		`"severity":"error","code":"ifKw","message":"syntax error: if-statement has been disabled but is present"}`+"\n"+
+		`{"file":"testdata/checkdir/blacklisted.gro","line":7,"column":1,"endLine":7,"endColumn":3,`+
+		`"severity":"error","code":"ifKw","message":"syntax error: if-statement has been disabled but is present"}`+"\n"+
+		`{"file":"testdata/checkdir/broken.gro","line":4,"column":17,"endLine":4,"endColumn":17,`+
+		`"severity":"error","message":"syntax error: unexpected newline, expecting comma or )"}`+"\n"+
+		`{"file":"testdata/checkdir/broken.gro","line":7,"column":6,"endLine":7,"endColumn":7,`+
+		`"severity":"error","message":"syntax error: unexpected =, expecting name"}`+"\n"+
+		`{"file":"testdata/checkdir/broken.gro","line":7,"column":9,"endLine":7,"endColumn":9,`+
+		`"severity":"error","message":"syntax error: unexpected newline, expecting type"}`+"\n" || sys.ExitStatus != 1 {
+		t.Errorf("wrong text received from Stderr for check with JSON output and file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -json somefile.gro' on a file with an error
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/checkdir/broken.gro"
+	main.Main([]string{"prepare", "-json", "-n", fn})
+	if fmt.Sprintf("%s", w) != `{"file":"testdata/checkdir/broken.gro","line":4,"column":17,"endLine":4,"endColumn":17,`+
+		`"severity":"error","message":"syntax error: unexpected newline, expecting comma or )"}`+"\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stderr for prepare with JSON output and file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -json somefile.gro' on a file in an include cycle
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/includes/cycle.gro"
+	main.Main([]string{"prepare", "-json", "-n", fn})
+	if fmt.Sprintf("%s", w) != `{"file":"testdata/includes/part.gro","line":1,"column":9,"endLine":1,"endColumn":9,`+
+		`"severity":"error","message":"include cycle: testdata/includes/cycle.gro:1:9 includes testdata/includes/part.gro, `+
+		`testdata/includes/part.gro:1:9 includes testdata/includes/cycle.gro",`+
+		`"includedFrom":["testdata/includes/cycle.gro:1:9"]}`+"\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stderr for prepare with JSON output and file %s as arg:\n%s\n", fn, w)
+	}
+
 	//--------------------------------------------------------------------------------
 	//calling 'gro execute' i.e. not enough args
 	w = new(bytes.Buffer)
 	sys.Stderr = w
 	main.Main([]string{"execute"})
-	if fmt.Sprintf("%s", w) != "gro: usage: gro execute path\n"+
+	if fmt.Sprintf("%s", w) != "gro: usage: gro execute path [-- arg ...]\n"+
 		"Not enough arguments given.\n" {
 		t.Errorf("wrong text received from Stderr for execute with no args:\n%s\n", w)
 	}
@@ -207,7 +541,7 @@ It then prints the generated Go source to the output files as determined by the
 	w = new(bytes.Buffer)
 	sys.Stderr = w
 	main.Main([]string{"execute", "file_one.gro", "file_two.gro"})
-	if fmt.Sprintf("%s", w) != "gro: usage: gro execute path\n"+
+	if fmt.Sprintf("%s", w) != "gro: usage: gro execute path [-- arg ...]\n"+
 		"Too many arguments given.\n" {
 		t.Errorf("wrong text received from Stderr for execute with no args:\n%s\n", w)
 	}
@@ -228,7 +562,7 @@ It then prints the generated Go source to the output files as determined by the
 	}
 
 	//--------------------------------------------------------------------------------
-	//calling 'gro execute somefile.gro' with message flag
+	//calling 'gro execute somefile.gro' with message flag, the program being cached
 	u = new(bytes.Buffer)
 	sys.Stdout = u
 	w = new(bytes.Buffer)
@@ -238,20 +572,36 @@ It then prints the generated Go source to the output files as determined by the
 	if fmt.Sprintf("%s", u) != "Hello, world!\n" {
 		t.Errorf("wrong text received from Stdout for execute with file %s as arg:\n%s\n", fn, u)
 	}
-	if fmt.Sprintf("%s", w) != "gro: preparing testdata/sayhi.gro\n"+
-		"gro: Received 1 files from ParsePackage.\n"+
+	if fmt.Sprintf("%s", w) != "gro: running cached build of testdata/sayhi.gro\n" {
+		t.Errorf("wrong text received from Stderr for execute with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro execute somefile.gro' with message flag and caching off, the file being up to date
+	os.Setenv(sys.CacheEnv, "off")
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/sayhi.gro"
+	main.Main([]string{"execute", "-v", fn})
+	os.Setenv(sys.CacheEnv, cache)
+	if fmt.Sprintf("%s", u) != "Hello, world!\n" {
+		t.Errorf("wrong text received from Stdout for execute with file %s as arg:\n%s\n", fn, u)
+	}
+	if fmt.Sprintf("%s", w) != "gro: testdata/sayhi.gro is up to date\n"+
 		"gro: running testdata/sayhi.go\n" {
 		t.Errorf("wrong text received from Stderr for execute with file %s as arg:\n%s\n", fn, w)
 	}
 
 	//--------------------------------------------------------------------------------
-	//calling 'gro execute executeInside.gro' with message flag
+	//calling 'gro execute executeInside.gro' with message flag, forcing it to be prepared
 	u = new(bytes.Buffer)
 	sys.Stdout = u
 	w = new(bytes.Buffer)
 	sys.Stderr = w
 	fn = "testdata/executeInside.gro"
-	main.Main([]string{"execute", "-v", fn})
+	main.Main([]string{"execute", "-a", "-v", fn})
 	if fmt.Sprintf("%s", u) != "'Hello, world!' from executeInside.gro\n"+
 		"Hello, world!\n" {
 		t.Errorf("wrong text received from Stdout for execute with file %s as arg:\n%s\n", fn, u)
@@ -262,5 +612,416 @@ It then prints the generated Go source to the output files as determined by the
 		t.Errorf("wrong text received from Stderr for execute with file %s as arg:\n%s\n", fn, w)
 	}
 
+	//--------------------------------------------------------------------------------
+	//calling 'gro execute somefile.gro -- args' with the program exiting with a non-zero status
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/exitcode.gro"
+	main.Main([]string{"execute", fn, "--", "-v", "two words"})
+	if fmt.Sprintf("%s", u) != "[-v two words]\n" {
+		t.Errorf("wrong text received from Stdout for execute with file %s and program args:\n%s\n", fn, u)
+	}
+	if fmt.Sprintf("%s", w) != "" || sys.ExitStatus != 3 {
+		t.Errorf("wrong text received from Stderr for execute with file %s and program args:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro execute -timeout d somefile.gro' with the program running for too long
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/sleep.gro"
+	main.Main([]string{"execute", "-timeout", "100ms", fn})
+	if fmt.Sprintf("%s", w) != "gro: testdata/sleep.go timed out after 100ms\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stderr for execute with timeout and file %s:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro execute -keep somefile.gro' with message flag, preparing it into a workspace kept afterwards
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/sayhi.gro"
+	main.Main([]string{"execute", "-keep", "-v", fn})
+	if fmt.Sprintf("%s", u) != "Hello, world!\n" {
+		t.Errorf("wrong text received from Stdout for execute -keep with file %s as arg:\n%s\n", fn, u)
+	}
+	lines := strings.Split(fmt.Sprintf("%s", w), "\n")
+	if len(lines) != 5 || lines[0] != "gro: preparing testdata/sayhi.gro" ||
+		!strings.HasPrefix(lines[3], "gro: keeping workspace ") {
+		t.Errorf("wrong text received from Stderr for execute -keep with file %s as arg:\n%s\n", fn, w)
+	} else {
+		ws := strings.TrimPrefix(lines[3], "gro: keeping workspace ")
+		if lines[2] != "gro: running "+filepath.Join(ws, "sayhi.go") {
+			t.Errorf("wrong go file run for execute -keep with file %s as arg:\n%s\n", fn, w)
+		}
+		if mod, err := ioutil.ReadFile(filepath.Join(ws, "go.mod")); err != nil || !strings.HasPrefix(string(mod), "module workspace\n") {
+			t.Errorf("wrong go.mod in workspace kept by execute -keep: %s %s\n", mod, err)
+		}
+		os.RemoveAll(filepath.Dir(filepath.Dir(ws)))
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro execute -hermetic somefile.gro' with message flag, the program built in a workspace being cached
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/sayhi.gro"
+	main.Main([]string{"execute", "-hermetic", "-v", fn})
+	if fmt.Sprintf("%s", u) != "Hello, world!\n" {
+		t.Errorf("wrong text received from Stdout for execute -hermetic with file %s as arg:\n%s\n", fn, u)
+	}
+	if fmt.Sprintf("%s", w) != "gro: running cached build of testdata/sayhi.gro\n" {
+		t.Errorf("wrong text received from Stderr for execute -hermetic with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro execute -hermetic -o dir somefile.gro'
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"execute", "-hermetic", "-o", "testdata", fn})
+	if fmt.Sprintf("%s", w) != "gro: a workspace can't be used with an output directory\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stderr for execute -hermetic with -o:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro cache list' after executing
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"cache", "list"})
+	for _, name := range []string{"sayhi.gro", "executeInside.gro", "exitcode.gro", "sleep.gro"} {
+		if !strings.Contains(fmt.Sprintf("%s", u), "testdata/"+name+"\n") {
+			t.Errorf("%s not received from Stdout for cache list:\n%s\n", name, u)
+		}
+	}
+	if fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stderr for cache list:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro cache clean'
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"cache", "clean"})
+	if files, err := ioutil.ReadDir(cache); err != nil || len(files) != 0 || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("cache not cleaned by cache clean: %v %s\n%s\n", files, err, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro cache' i.e. not enough args
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"cache"})
+	if fmt.Sprintf("%s", w) != "gro: usage: gro cache list|clean|dir\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stderr for cache with no args:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro run' i.e. not enough args
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"run"})
+	if fmt.Sprintf("%s", w) != "gro: usage: gro run path [-- arg ...]\n"+
+		"Not enough arguments given.\n" {
+		t.Errorf("wrong text received from Stderr for run with no args:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro run somefile.go -- args' on an already generated go file
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/exitcode.go"
+	main.Main([]string{"run", fn, "--", "again"})
+	if fmt.Sprintf("%s", u) != "[again]\n" {
+		t.Errorf("wrong text received from Stdout for run with file %s and program args:\n%s\n", fn, u)
+	}
+	if fmt.Sprintf("%s", w) != "" || sys.ExitStatus != 3 {
+		t.Errorf("wrong text received from Stderr for run with file %s and program args:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro test -run regexp somedir' with message flag, forcing it to be prepared
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/testcode"
+	main.Main([]string{"test", "-a", "-v", "-run", "Add", fn})
+	if !strings.Contains(fmt.Sprintf("%s", u), "--- PASS: TestAdd") || strings.Contains(fmt.Sprintf("%s", u), "TestSub") {
+		t.Errorf("wrong text received from Stdout for test with file %s as arg:\n%s\n", fn, u)
+	}
+	if fmt.Sprintf("%s", w) != "gro: preparing testdata/testcode/adder.gro\n"+
+		"gro: Received 2 files from ParsePackage.\n"+
+		"gro: testing ./testdata/testcode\n" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received from Stderr for test with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro test somedir' on files without testcode sections
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/grodir"
+	main.Main([]string{"test", fn})
+	if fmt.Sprintf("%s", w) != "gro: no testcode sections found\n" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received from Stderr for test with file %s as arg:\n%s\n", fn, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro clean somedir' with a go file changed since it was generated
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"clean", out})
+	if fmt.Sprintf("%s", w) != "gro: "+shown+" has changed since it was generated, so is kept\n" || sys.ExitStatus != 1 {
+		t.Errorf("wrong text received from Stderr for clean with changed file %s:\n%s\n", shown, w)
+	}
+	if _, err := os.Stat(gofn); err != nil {
+		t.Errorf("clean with changed file %s: %s\n", shown, err)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro clean -n somedir' i.e. dry run, after preparing the changed go file again
+	main.Main([]string{"prepare", "-o", out, "testdata/sayhi.gro"})
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"clean", "-n", out})
+	if fmt.Sprintf("%s", u) != shown+"\n" || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for dry run of clean with dir %s:\n%s\n", out, u)
+	}
+	if _, err := os.Stat(gofn); err != nil {
+		t.Errorf("dry run of clean with dir %s: %s\n", out, err)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro clean somedir' with message flag
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"clean", "-v", out})
+	if fmt.Sprintf("%s", w) != "gro: removing "+shown+"\n" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received from Stderr for clean with dir %s:\n%s\n", out, w)
+	}
+	if files, _ := ioutil.ReadDir(out); len(files) != 0 {
+		t.Errorf("files left in dir %s after clean: %v\n", out, files)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro doc' with no path
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"doc"})
+	if fmt.Sprintf("%s", w) != "gro: usage: gro doc [-html] path ...\nNot enough arguments given.\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stderr for doc with no path:\n%s\n", w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro doc somefile'
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"doc", "testdata/docs/cool.grog"})
+	if fmt.Sprintf("%s", u) != docStr || fmt.Sprintf("%s", w) != "" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received from Stdout for doc:\n%s\n%s\n", u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro doc -html somefile'
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	main.Main([]string{"doc", "-html", "testdata/docs/cool.grog"})
+	if html := fmt.Sprintf("%s", u); !strings.HasPrefix(html, "<!DOCTYPE html>") ||
+		!strings.Contains(html, "<h2 id=\"github.com/grolang/gro/cmd/gro/testdata/docs/list\">Package list(E)</h2>\n") ||
+		!strings.Contains(html, "<h3>section \"shapes\"</h3>\n<pre>type Point struct {\n\tX, Y int\n}</pre>\n") {
+		t.Errorf("wrong html received from Stdout for doc:\n%s\n", u)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro profiles'
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"profiles"})
+	if prof := fmt.Sprintf("%s", u); !strings.HasPrefix(prof, "g0010: enough for a minimal program\n"+
+		"    packageKw       enable use of the package keyword\n") ||
+		!strings.Contains(prof, "\ngro (also no extension): standard grolang extensions\n    assert ") ||
+		!strings.Contains(prof, "\n    ifKw          enable use of the if keyword\n") ||
+		!strings.HasSuffix(prof, "\n\ngrooy: hash-cmds, which rely on dynamic typing\n") || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for profiles:\n%s\n%s\n", u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro profiles somefile' with permits blacklisted
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/permits/blacklist.gro"
+	main.Main([]string{"profiles", fn})
+	if prof := fmt.Sprintf("%s", u); !strings.HasPrefix(prof, fn+": profile gro\n    packageKw ") ||
+		!strings.Contains(prof, "\n    ifKw                          g0200, disabled\n") ||
+		!strings.Contains(prof, "\n    elseKw                        g0200\n") ||
+		!strings.HasSuffix(prof, "\n    escapeEscapeInStrings         gro\n") || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for profiles with file %s:\n%s\n%s\n", fn, u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro profiles somefile' with permits blacklisted and used, reporting the errors
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/checkdir/blacklisted.gro"
+	main.Main([]string{"profiles", fn})
+	if prof := fmt.Sprintf("%s", u); !strings.HasPrefix(prof, fn+": profile gro\n    packageKw ") ||
+		!strings.Contains(prof, "\n    ifKw                          g0200, disabled\n") ||
+		fmt.Sprintf("%s", w) != "gro: "+fn+":4:1: syntax error: if-statement has been disabled but is present\n"+
+			"gro: "+fn+":7:1: syntax error: if-statement has been disabled but is present\n" || sys.ExitStatus != 2 {
+		t.Errorf("wrong text received from Stdout for profiles with file %s:\n%s\n%s\n", fn, u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro profiles somefile' with the profile and blacklist given by a gro.cfg file
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/configured/main.gro"
+	main.Main([]string{"profiles", fn})
+	if prof := fmt.Sprintf("%s", u); !strings.HasPrefix(prof, fn+": profile g0450\n") ||
+		!strings.Contains(prof, "\n    ifKw                        g0200, disabled\n") ||
+		!strings.HasSuffix(prof, "\n    callExprsAndConverts        g0450\n") || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for profiles with file %s:\n%s\n%s\n", fn, u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -n somefile' with the output directory given by a gro.cfg file
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"prepare", "-n", fn})
+	if fmt.Sprintf("%s", u) != "testdata/configured/gen/main.go\n" || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for dry run of prepare with file %s as arg:\n%s\n%s\n", fn, u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro profiles somefile' with a user profile defined by the files a gro.cfg file gives
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	fn = "testdata/profiled/lesson.basics"
+	main.Main([]string{"profiles", fn})
+	if prof := fmt.Sprintf("%s", u); !strings.HasPrefix(prof, fn+": profile basics\n") ||
+		!strings.Contains(prof, "\n    elseKw                      g0200, disabled\n") ||
+		!strings.HasSuffix(prof, "\n    funcKw                      basics\n    useKw                       basics\n") || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for profiles with file %s:\n%s\n%s\n", fn, u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro prepare -n somefile' with a user profile
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	main.Main([]string{"prepare", "-n", fn})
+	if fmt.Sprintf("%s", u) != "testdata/profiled/lesson.go\n" || fmt.Sprintf("%s", w) != "" {
+		t.Errorf("wrong text received from Stdout for dry run of prepare with file %s as arg:\n%s\n%s\n", fn, u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro repl' with entries on the standard input
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	sys.Stdin = strings.NewReader("a := 1 + 2\na * 10\nif a > 2 {\n\t\"fmt\".Println(\"big\")\n}\nnope\n")
+	main.Main([]string{"repl"})
+	if fmt.Sprintf("%s", u) != "groo> groo> 30\ngroo> ....> ....> big\ngroo> groo> \n" ||
+		fmt.Sprintf("%s", w) != "gro: undefined: nope\n" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received for repl:\n%s\n%s\n", u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro repl' with variables carried over, rather than run again
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	sys.Stdin = strings.NewReader("t := \"time\".Now().UnixNano()\n\"time\".Now().UnixNano() - t > 10000000\nb := /* ( */ 4\nq := &b\nb\n")
+	main.Main([]string{"repl"})
+	if fmt.Sprintf("%s", u) != "groo> groo> true\ngroo> groo> groo> 4\ngroo> \n" ||
+		fmt.Sprintf("%s", w) != "gro: q is dropped, as its value can't be carried over to later entries\n" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received for repl with variables carried over:\n%s\n%s\n", u, w)
+	}
+
+	//--------------------------------------------------------------------------------
+	//calling 'gro repl' with big numbers carried over
+	u = new(bytes.Buffer)
+	sys.Stdout = u
+	w = new(bytes.Buffer)
+	sys.Stderr = w
+	sys.Stdin = strings.NewReader("x := 3000000000*3000000000*3000000000\ny := 5 / 3\nx + 1\ny * 2\n")
+	main.Main([]string{"repl"})
+	if fmt.Sprintf("%s", u) != "groo> groo> groo> 27000000000000000000000000001\ngroo> 10/3\ngroo> \n" ||
+		fmt.Sprintf("%s", w) != "" || sys.ExitStatus != 0 {
+		t.Errorf("wrong text received for repl with big numbers carried over:\n%s\n%s\n", u, w)
+	}
+
 	//--------------------------------------------------------------------------------
 }
+
+const docStr = `PROJECT cool
+
+    Cool shows what gro doc prints.
+
+    It has two packages.
+
+PACKAGE abc
+    import "github.com/grolang/gro/cmd/gro/testdata/docs/abc"
+
+    Package abc adds numbers.
+
+    const C = 3
+        C is three.
+
+    var X = 1
+        Vars are grouped.
+
+    func Add(a, b int) int
+        Add adds two numbers.
+
+  section "shapes"
+
+    type Point struct {
+    	X, Y int
+    }
+        Point is a point on a plane.
+
+    func (p *Point) Move(dx, dy int)
+        Move moves a point.
+
+PACKAGE list(E)
+    import "github.com/grolang/gro/cmd/gro/testdata/docs/list"
+
+    Package list holds lists of any type.
+
+    type List []E
+        List is a list of Es.
+
+    func (l List) Len() int
+        Len returns the length of the list.
+`
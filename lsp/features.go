@@ -0,0 +1,266 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/grolang/gro/nodes"
+	"github.com/grolang/gro/syntax"
+)
+
+//================================================================================
+// diagnostic returns the diagnostic for an error found parsing a document.
+// Errors in the files it includes are given at the include declaration in the
+// document, and any others not at a position in it at its start.
+func (d *document) diagnostic(err error) diagnostic {
+	diag := diagnostic{Severity: 1, Source: "gro", Message: err.Error()}
+	se, ok := err.(syntax.Error)
+	if ok && len(se.Trail) > 0 && se.Trail[len(se.Trail)-1].Filename() == d.path {
+		decl := se.Trail[len(se.Trail)-1]
+		diag.Range.Start = positionIn(d.text, decl.Line(), decl.Col())
+		diag.Range.End = diag.Range.Start
+		return diag
+	}
+	if ok && se.Pos.IsKnown() && se.Pos.Filename() == d.path {
+		diag.Range.Start = positionIn(d.text, se.Pos.Line(), se.Pos.Col())
+		diag.Range.End = diag.Range.Start
+		if se.End.IsKnown() {
+			diag.Range.End = positionIn(d.text, se.End.Line(), se.End.Col())
+		}
+		diag.Code, diag.Message = se.Code, se.Msg
+	}
+	return diag
+}
+
+//================================================================================
+// definition returns where the name at a position in a document is declared,
+// at the top level of any of its packages or sections. A name declared inside
+// a function has no definition given, as it shadows any at the top level.
+func (s *server) definition(doc *document, p position) []location {
+	word, line, col := doc.word(p)
+	locs := []location{}
+	if word == "" {
+		return locs
+	}
+	for pos := range syntax.LocalNames(doc.files) {
+		if pos.Filename() == doc.path && pos.Line() == line && pos.Col() == col {
+			return locs
+		}
+	}
+	seen := map[string]bool{}
+	for _, name := range declNames(doc.files) {
+		pos := name.Pos()
+		if name.Value != word || !pos.IsKnown() || seen[pos.String()] {
+			continue
+		}
+		seen[pos.String()] = true
+		text := doc.text
+		if pos.Filename() != doc.path {
+			text, _ = s.getFile(pos.Filename()) // if it's gone, the columns are taken as characters
+		}
+		start := positionIn(text, pos.Line(), pos.Col())
+		end := start
+		end.Character += utf16Len(word)
+		locs = append(locs, location{URI: uriOf(pos.Filename()), Range: textRange{start, end}})
+	}
+	return locs
+}
+
+//--------------------------------------------------------------------------------
+// declNames returns the names declared at the top level of the Go files.
+func declNames(files map[string]*nodes.File) []*nodes.Name {
+	var names []*nodes.Name
+	for _, fn := range sortedFiles(files) {
+		for _, decl := range files[fn].DeclList {
+			switch decl := decl.(type) {
+			case *nodes.FuncDecl:
+				names = append(names, decl.Name)
+			case *nodes.TypeDecl:
+				names = append(names, decl.Name)
+			case *nodes.VarDecl:
+				names = append(names, decl.NameList...)
+			case *nodes.ConstDecl:
+				names = append(names, decl.NameList...)
+			}
+		}
+	}
+	return names
+}
+
+//--------------------------------------------------------------------------------
+// word returns the identifier at a position in the document, if any, with the
+// line and byte column it starts at.
+func (d *document) word(p position) (word string, line, col uint) {
+	line, col = d.lineCol(p)
+	text := lineOf(d.text, line)
+	start, end := int(col)-1, int(col)-1
+	for start > 0 {
+		r, w := utf8.DecodeLastRuneInString(text[:start])
+		if !isIdentRune(r) {
+			break
+		}
+		start -= w
+	}
+	for end < len(text) {
+		r, w := utf8.DecodeRuneInString(text[end:])
+		if !isIdentRune(r) {
+			break
+		}
+		end += w
+	}
+	if r, _ := utf8.DecodeRuneInString(text[start:end]); unicode.IsDigit(r) {
+		return "", line, col
+	}
+	return text[start:end], line, uint(start) + 1
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+//================================================================================
+// hover returns the Go code that the statement or declaration at a position in
+// the document expands to, or nil if there's none there. The innermost one
+// starting on the line of the position is used, preferring the last to start
+// before the position when there are several.
+func (d *document) hover(p position) *hover {
+	line, col := d.lineCol(p)
+	var found nodes.Node
+	visit := func(n nodes.Node) {
+		pos := n.Pos()
+		if pos.IsKnown() && pos.Filename() == d.path && pos.Line() == line && (found == nil || pos.Col() <= col) {
+			found = n
+		}
+	}
+	for _, fn := range sortedFiles(d.files) {
+		for _, decl := range d.files[fn].DeclList {
+			switch decl := decl.(type) {
+			case *nodes.FuncDecl:
+				sig := *decl
+				sig.Body = nil
+				visit(&sig)
+				if decl.Body != nil {
+					walkStmts(decl.Body.List, visit)
+				}
+			case *nodes.TypeDecl, *nodes.VarDecl, *nodes.ConstDecl:
+				visit(decl)
+			}
+		}
+	}
+	if found == nil {
+		return nil
+	}
+
+	h := &hover{}
+	h.Contents.Kind = "markdown"
+	h.Contents.Value = "```go\n" + strings.TrimSpace(syntax.StringWithLinebreaks(found)) + "\n```"
+	h.Range.Start = positionIn(d.text, line, found.Pos().Col())
+	h.Range.End = positionIn(d.text, line, uint(len(lineOf(d.text, line)))+1)
+	return h
+}
+
+//--------------------------------------------------------------------------------
+// walkStmts calls visit with each statement in the list, and those nested in
+// them, outer ones first.
+func walkStmts(list []nodes.Stmt, visit func(nodes.Node)) {
+	for _, stmt := range list {
+		if stmt == nil {
+			continue
+		}
+		visit(stmt)
+		switch stmt := stmt.(type) {
+		case *nodes.BlockStmt:
+			walkStmts(stmt.List, visit)
+		case *nodes.LabeledStmt:
+			walkStmts([]nodes.Stmt{stmt.Stmt}, visit)
+		case *nodes.IfStmt:
+			if stmt.Then != nil {
+				walkStmts(stmt.Then.List, visit)
+			}
+			if stmt.Else != nil {
+				walkStmts([]nodes.Stmt{stmt.Else}, visit)
+			}
+		case *nodes.ForStmt:
+			if stmt.Body != nil {
+				walkStmts(stmt.Body.List, visit)
+			}
+		case *nodes.SwitchStmt:
+			for _, cc := range stmt.Body {
+				walkStmts(cc.Body, visit)
+			}
+		case *nodes.SelectStmt:
+			for _, cc := range stmt.Body {
+				walkStmts(cc.Body, visit)
+			}
+		}
+	}
+}
+
+//================================================================================
+// format returns the edit formatting the document, if it needs one. A document
+// with lexical errors is left alone, as the errors are already published.
+func (d *document) format() []textEdit {
+	text, err := syntax.Format(d.path, []byte(d.text))
+	if err != nil || string(text) == d.text {
+		return []textEdit{}
+	}
+	lines := strings.Split(d.text, "\n")
+	end := position{Line: len(lines) - 1, Character: utf16Len(lines[len(lines)-1])}
+	return []textEdit{{Range: textRange{End: end}, NewText: string(text)}}
+}
+
+//================================================================================
+// positionIn returns the position of a line and byte column in the text, both
+// counting from one as the parser gives them.
+func positionIn(text string, line, col uint) position {
+	prefix := lineOf(text, line)
+	if col >= 1 && int(col)-1 < len(prefix) {
+		prefix = prefix[:col-1]
+	}
+	return position{Line: int(line) - 1, Character: utf16Len(prefix)}
+}
+
+// lineCol returns the line and byte column of a position in the document,
+// counting from one.
+func (d *document) lineCol(p position) (line, col uint) {
+	text := lineOf(d.text, uint(p.Line)+1)
+	n := 0
+	for i, r := range text {
+		if n >= p.Character {
+			return uint(p.Line) + 1, uint(i) + 1
+		}
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return uint(p.Line) + 1, uint(len(text)) + 1
+}
+
+// lineOf returns a line of the text, counting from one, without its newline.
+func lineOf(text string, line uint) string {
+	lines := strings.Split(text, "\n")
+	if line < 1 || int(line) > len(lines) {
+		return ""
+	}
+	return lines[line-1]
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func sortedFiles(files map[string]*nodes.File) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//================================================================================
@@ -0,0 +1,206 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the JSON-RPC messages of the Language Server Protocol,
+// each preceded by a Content-Length header, and the parts of the protocol used.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//================================================================================
+// A message is a request, a response, or a notification, which is a request
+// without an ID.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"` // set to null rather than omitted when there's no error
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// error codes
+const (
+	parseError     = -32700
+	invalidRequest = -32600
+	methodNotFound = -32601
+	invalidParams  = -32602
+	internalError  = -32603
+	notInitialized = -32002
+)
+
+//--------------------------------------------------------------------------------
+// readMessage reads the next message, returning io.EOF if there are no more.
+func readMessage(r *bufio.Reader) (*message, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading header: %s", err)
+	}
+	size, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("bad Content-Length %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading content: %s", err)
+	}
+	msg := &message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, &rpcError{parseError, err.Error()}
+	}
+	return msg, nil
+}
+
+//--------------------------------------------------------------------------------
+// writeMessage writes a message with its header.
+func writeMessage(w io.Writer, msg *message) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err == nil {
+		_, err = w.Write(data)
+	}
+	return err
+}
+
+//================================================================================
+// the parts of the protocol used, with positions counting from zero and
+// characters in UTF-16 code units
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string    `json:"uri"`
+	Range textRange `json:"range"`
+}
+
+type diagnostic struct {
+	Range    textRange `json:"range"`
+	Severity int       `json:"severity"` // 1 is error
+	Code     string    `json:"code,omitempty"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+// Only full changes are accepted, as declared in the server capabilities.
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type documentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type positionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type hover struct {
+	Contents struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	} `json:"contents"`
+	Range textRange `json:"range"`
+}
+
+type textEdit struct {
+	Range   textRange `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+//--------------------------------------------------------------------------------
+// capabilities are those of the server, sent in reply to initialize.
+var capabilities = map[string]interface{}{
+	"textDocumentSync": map[string]interface{}{
+		"openClose": true,
+		"change":    1, // full text
+		"save":      true,
+	},
+	"hoverProvider":              true,
+	"definitionProvider":         true,
+	"documentFormattingProvider": true,
+}
+
+//================================================================================
+// pathOf returns the filename of a file URI, or else the URI itself.
+func pathOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	pth := u.Path
+	if runtime.GOOS == "windows" {
+		pth = strings.TrimPrefix(pth, "/") // as in /C:/dir
+	}
+	return filepath.FromSlash(pth)
+}
+
+// uriOf returns the URI of a filename.
+func uriOf(filename string) string {
+	if strings.Contains(filename, ":") && !filepath.IsAbs(filename) {
+		return filename // not from a file URI
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	pth := filepath.ToSlash(filename)
+	if !strings.HasPrefix(pth, "/") {
+		pth = "/" + pth
+	}
+	return (&url.URL{Scheme: "file", Path: pth}).String()
+}
+
+//================================================================================
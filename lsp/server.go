@@ -0,0 +1,276 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lsp implements a Language Server Protocol server for Gro files, as
+// run by gro lsp. It publishes the errors the parser finds, finds where names
+// are declared, shows the Go code a statement expands to, and formats files.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/grolang/gro/nodes"
+	"github.com/grolang/gro/syntax"
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+// A server holds the documents open in the client.
+type server struct {
+	out  io.Writer
+	msgs io.Writer // nil means no messages
+
+	docs        map[string]*document // by URI
+	initialized bool
+	shutdown    bool
+}
+
+// A document is a Gro file open in the client.
+type document struct {
+	uri  string
+	path string
+	text string
+
+	files map[string]*nodes.File // Go files generated when it last parsed without errors
+}
+
+//--------------------------------------------------------------------------------
+// Serve reads requests from in and writes the responses to out until the exit
+// notification is received, or in ends. It returns an error if the server
+// stops without having been shut down. If msgs is non-nil, the method of each
+// message received is printed to it.
+func Serve(in io.Reader, out io.Writer, msgs io.Writer) error {
+	s := &server{out: out, msgs: msgs, docs: map[string]*document{}}
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		switch err.(type) {
+		case nil:
+		case *rpcError:
+			if err := s.reply(nil, nil, err); err != nil {
+				return err
+			}
+			continue
+		default:
+			if err == io.EOF {
+				if s.shutdown {
+					return nil
+				}
+				err = errors.New("input ended without shutdown")
+			}
+			return err
+		}
+		if s.msgs != nil {
+			fmt.Fprintf(s.msgs, "gro: lsp: received %s\n", msg.Method)
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil { // a notification, or a response to a request never made
+			if err != nil && s.msgs != nil {
+				fmt.Fprintf(s.msgs, "gro: lsp: %s: %s\n", msg.Method, err)
+			}
+			continue
+		}
+		if err := s.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+// reply writes the response to a request, with either the result or the error.
+func (s *server) reply(id *json.RawMessage, result interface{}, err error) error {
+	resp := &message{ID: id}
+	if id == nil {
+		null := json.RawMessage("null")
+		resp.ID = &null
+	}
+	if err != nil {
+		rerr, ok := err.(*rpcError)
+		if !ok {
+			rerr = &rpcError{internalError, err.Error()}
+		}
+		resp.Error = rerr
+	} else if resp.Result, err = json.Marshal(result); err != nil {
+		return err
+	}
+	return writeMessage(s.out, resp)
+}
+
+//--------------------------------------------------------------------------------
+// notify sends a notification to the client.
+func (s *server) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: data})
+}
+
+//--------------------------------------------------------------------------------
+// handle handles a message other than exit, returning the result of a request.
+func (s *server) handle(msg *message) (result interface{}, err error) {
+	defer func() {
+		if pnc := recover(); pnc != nil {
+			result, err = nil, fmt.Errorf("internal error handling %s: %v", msg.Method, pnc)
+		}
+	}()
+
+	switch {
+	case msg.Method == "initialize":
+		s.initialized = true
+		return map[string]interface{}{
+			"capabilities": capabilities,
+			"serverInfo":   map[string]string{"name": "gro"},
+		}, nil
+	case !s.initialized:
+		return nil, &rpcError{notInitialized, "initialize not received"}
+	case s.shutdown:
+		return nil, &rpcError{invalidRequest, "server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc := &document{uri: params.TextDocument.URI, path: pathOf(params.TextDocument.URI)}
+		s.docs[doc.uri] = doc
+		return nil, s.update(doc, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument)
+		if err != nil || len(params.ContentChanges) == 0 {
+			return nil, err
+		}
+		return nil, s.update(doc, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didSave": // files it includes may have been saved too
+		var params documentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.update(doc, doc.text)
+	case "textDocument/didClose":
+		var params documentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics",
+			publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+
+	case "textDocument/definition":
+		var params positionParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.definition(doc, params.Position), nil
+	case "textDocument/hover":
+		var params positionParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		if h := doc.hover(params.Position); h != nil {
+			return h, nil
+		}
+		return nil, nil
+	case "textDocument/formatting":
+		var params documentParams
+		if err := unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return doc.format(), nil
+	}
+	return nil, &rpcError{methodNotFound, "method not supported: " + msg.Method}
+}
+
+//--------------------------------------------------------------------------------
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{invalidParams, err.Error()}
+	}
+	return nil
+}
+
+//--------------------------------------------------------------------------------
+// document returns the open document with the given identifier.
+func (s *server) document(id textDocumentIdentifier) (*document, error) {
+	doc, ok := s.docs[id.URI]
+	if !ok {
+		return nil, &rpcError{invalidParams, "document not open: " + id.URI}
+	}
+	return doc, nil
+}
+
+//================================================================================
+// update sets the text of a document, parses it, and publishes the errors found.
+func (s *server) update(doc *document, text string) error {
+	doc.text = text
+	var errs []error
+	errh := func(err error) {
+		errs = append(errs, err)
+	}
+	files, err := syntax.ParseBytes(doc.path, src.NewFileBase(doc.path, doc.path), []byte(text), errh, nil, 0, s.getFile)
+	if err != nil && len(errs) == 0 { // not passed to errh
+		errs = append(errs, err)
+	}
+	if err == nil {
+		doc.files = files
+	}
+
+	diags := []diagnostic{}
+	for _, err := range errs {
+		diags = append(diags, doc.diagnostic(err))
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: doc.uri, Diagnostics: diags})
+}
+
+//--------------------------------------------------------------------------------
+// getFile returns the text of a file parsed along with a document, using the
+// text in the client if the file is open there.
+func (s *server) getFile(filename string) (string, error) {
+	if doc, ok := s.docs[uriOf(filename)]; ok {
+		return doc.text, nil
+	}
+	text, err := ioutil.ReadFile(filename)
+	return string(text), err
+}
+
+//================================================================================
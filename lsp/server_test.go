@@ -0,0 +1,147 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//================================================================================
+func TestServe(t *testing.T) {
+	uri := uriOf("double.gro") // never read, as it is open
+	doc := map[string]interface{}{"uri": uri}
+	good := "package main\n\nfunc double(n int) int {\n  return n*2\n}\n\ndo x := double(2)\nassert x == 4\n"
+	bad := "package main\n\nfunc double(n int {\n}\n"
+
+	var in bytes.Buffer
+	for _, msg := range []struct {
+		id     int // 0 means a notification
+		method string
+		params interface{}
+	}{
+		{1, "initialize", map[string]interface{}{}},
+		{0, "initialized", map[string]interface{}{}},
+		{0, "textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+			"uri": uri, "languageId": "gro", "version": 1, "text": bad}}},
+		{0, "textDocument/didChange", map[string]interface{}{"textDocument": doc,
+			"contentChanges": []interface{}{map[string]string{"text": good}}}},
+		{2, "textDocument/definition", map[string]interface{}{"textDocument": doc,
+			"position": position{Line: 6, Character: 10}}},
+		{3, "textDocument/hover", map[string]interface{}{"textDocument": doc,
+			"position": position{Line: 7, Character: 3}}},
+		{4, "textDocument/formatting", map[string]interface{}{"textDocument": doc}},
+		{5, "textDocument/rename", map[string]interface{}{"textDocument": doc}},
+		{6, "shutdown", nil},
+		{0, "exit", nil},
+	} {
+		params, _ := json.Marshal(msg.params)
+		m := &message{Method: msg.method, Params: params}
+		if msg.id != 0 {
+			id := json.RawMessage(strconv.Itoa(msg.id))
+			m.ID = &id
+		}
+		if err := writeMessage(&in, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Serve(&in, &out, nil); err != nil {
+		t.Fatalf("Serve returned error: %s", err)
+	}
+	var diags []publishDiagnosticsParams
+	results := map[string]*message{}
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID == nil {
+			var params publishDiagnosticsParams
+			json.Unmarshal(msg.Params, &params)
+			diags = append(diags, params)
+			continue
+		}
+		results[string(*msg.ID)] = msg
+	}
+
+	if len(diags) != 2 || len(diags[0].Diagnostics) != 2 || len(diags[1].Diagnostics) != 0 {
+		t.Fatalf("wrong diagnostics received: %+v", diags)
+	}
+	if d := diags[0].Diagnostics[0]; d.Range.Start.Line != 2 || d.Source != "gro" || !strings.Contains(d.Message, "syntax error") {
+		t.Errorf("wrong diagnostic received for file with error: %+v", d)
+	}
+
+	var locs []location
+	json.Unmarshal(results["2"].Result, &locs)
+	if len(locs) != 1 || locs[0].URI != uri ||
+		locs[0].Range != (textRange{position{2, 5}, position{2, 11}}) {
+		t.Errorf("wrong definition received: %s", results["2"].Result)
+	}
+
+	var h hover
+	json.Unmarshal(results["3"].Result, &h)
+	if h.Contents.Value != "```go\nassert.AssertTrue(x == 4)\n```" {
+		t.Errorf("wrong hover received: %s", results["3"].Result)
+	}
+
+	var edits []textEdit
+	json.Unmarshal(results["4"].Result, &edits)
+	if len(edits) != 1 || edits[0].NewText != strings.Replace(good, "  return", "\treturn", 1) ||
+		edits[0].Range.End != (position{8, 0}) {
+		t.Errorf("wrong formatting edits received: %s", results["4"].Result)
+	}
+
+	if e := results["5"].Error; e == nil || e.Code != methodNotFound {
+		t.Errorf("wrong error received for unsupported method: %+v", e)
+	}
+	if res := results["6"]; res.Error != nil || string(res.Result) != "null" {
+		t.Errorf("wrong response received for shutdown: %+v", res)
+	}
+
+	//exit without shutdown
+	in.Reset()
+	writeMessage(&in, &message{Method: "exit"})
+	if err := Serve(&in, &out, nil); err == nil {
+		t.Errorf("no error returned for exit without shutdown")
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestDefinitionShadowed(t *testing.T) {
+	s := &server{out: ioutil.Discard, docs: map[string]*document{}}
+	uri := uriOf("shadow.gro")
+	doc := &document{uri: uri, path: pathOf(uri)}
+	s.docs[uri] = doc
+	text := "package main\n\nvar n = 1\n\nfunc double(n int) int {\n\treturn n * 2\n}\n\nfunc main() { println(n) }\n"
+	if err := s.update(doc, text); err != nil || doc.files == nil {
+		t.Fatalf("document not parsed: %v", err)
+	}
+	for _, tst := range []struct {
+		pos  position
+		want int
+	}{
+		{position{5, 8}, 0},  // the parameter
+		{position{4, 12}, 0}, // its declaration
+		{position{8, 22}, 1}, // the variable at the top level
+	} {
+		locs := s.definition(doc, tst.pos)
+		if len(locs) != tst.want || tst.want > 0 && locs[0].Range.Start != (position{2, 4}) {
+			t.Errorf("wrong definition received for %v: %+v", tst.pos, locs)
+		}
+	}
+}
+
+//================================================================================
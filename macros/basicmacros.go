@@ -74,7 +74,7 @@ func InitDynamic(p nodes.GeneralParser, rets []string, args []string) {
 //--------------------------------------------------------------------------------
 func GroSystemCmd(p nodes.GeneralParser, s string) nodes.Stmt {
 	if !p.IsPermit(s) {
-		p.SyntaxError(fmt.Sprintf("\"%s\" command disabled but is present", s))
+		p.PermitError(s, fmt.Sprintf("\"%s\" command disabled but is present", s))
 		return nil
 	}
 	switch s {
@@ -110,7 +110,7 @@ func GroSystemCmd(p nodes.GeneralParser, s string) nodes.Stmt {
 //--------------------------------------------------------------------------------
 func Assert(p nodes.GeneralParser) nodes.Stmt {
 	if !p.IsPermit("assert") {
-		p.SyntaxError("\"assert\" macro disabled but is present")
+		p.PermitError("assert", "\"assert\" macro disabled but is present")
 		return nil
 	}
 
@@ -157,7 +157,7 @@ func Assert(p nodes.GeneralParser) nodes.Stmt {
 //--------------------------------------------------------------------------------
 func Let(p nodes.GeneralParser, stmt func() nodes.Stmt) nodes.Stmt {
 	if !p.IsPermit("let") {
-		p.SyntaxError("\"let\" macro disabled but is present")
+		p.PermitError("let", "\"let\" macro disabled but is present")
 		return nil
 	}
 	pos := p.Pos()
@@ -195,6 +195,19 @@ func InitLineDirectives(p nodes.GeneralParser, rets, args []string) {
 	p.SetLineDirectives(true)
 }
 
+//--------------------------------------------------------------------------------
+// permitGroups are the features a blacklist or whitelist can name as a whole,
+// each with the keyword permits it needs, its own first. The others can be
+// shared with other features.
+var permitGroups = map[string][]string{
+	"package": {"packageKw", "internalKw"},
+	"section": {"sectionKw", "mainKw", "testcodeKw"},
+	"if":      {"ifKw", "elseKw"},
+	"switch":  {"switchKw", "caseKw", "defaultKw", "fallthroughKw", "breakKw"},
+	"select":  {"selectKw", "caseKw", "defaultKw", "breakKw"},
+	"for":     {"forKw", "rangeKw", "continueKw", "breakKw"},
+}
+
 //--------------------------------------------------------------------------------
 func InitBlacklist(p nodes.GeneralParser, rets, args []string) {
 	if len(rets) != 0 {
@@ -202,53 +215,78 @@ func InitBlacklist(p nodes.GeneralParser, rets, args []string) {
 		return
 	}
 	for _, s := range args {
-		switch s {
-		default:
+		group, ok := permitGroups[s]
+		if !ok {
 			p.UnsetPermit(s)
-		case "package":
-			p.UnsetPermit("package")
-			p.UnsetPermit("internal")
-		case "section":
-			p.UnsetPermit("section")
-			p.UnsetPermit("main")
-			p.UnsetPermit("testcode")
-		case "if":
-			p.UnsetPermit("if")
-			p.UnsetPermit("else")
-		case "switch":
-			p.UnsetPermit("switch")
-			p.UnsetPermit("fallthrough")
-			if !p.IsPermit("select") {
-				p.UnsetPermit("case")
-				p.UnsetPermit("default")
-			}
-			if !p.IsPermit("for") && !p.IsPermit("select") {
-				p.UnsetPermit("break")
-			}
-		case "select":
-			p.UnsetPermit("select")
-			if !p.IsPermit("switch") {
-				p.UnsetPermit("case")
-				p.UnsetPermit("default")
-			}
-			if !p.IsPermit("for") && !p.IsPermit("switch") {
-				p.UnsetPermit("break")
-			}
-		case "for":
-			p.UnsetPermit("for")
-			p.UnsetPermit("range")
-			p.UnsetPermit("continue")
-			if !p.IsPermit("switch") && !p.IsPermit("select") {
-				p.UnsetPermit("break")
+			continue
+		}
+		p.UnsetPermit(group[0])
+	shared:
+		for _, permit := range group[1:] {
+			for other, og := range permitGroups {
+				if other != s && p.IsPermit(og[0]) && contains(og[1:], permit) {
+					continue shared // still needed by the other feature
+				}
 			}
+			p.UnsetPermit(permit)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+// InitWhitelist disables every permit but those named, so a file can use only
+// the features it opts into. A feature named as a whole, such as "switch",
+// brings the keywords it needs with it. The permits of the header keywords are
+// left as they were, so the rest of the header can still be parsed, and other
+// uses can come after it.
+func InitWhitelist(p nodes.GeneralParser, rets, args []string) {
+	if len(rets) != 0 {
+		p.SyntaxError("use \"whitelist\" shouldn't return any names but does")
+		return
+	}
+	for _, s := range args {
+		if _, ok := permitGroups[s]; !ok && !p.IsPermitName(s) {
+			p.SyntaxError(fmt.Sprintf("use \"whitelist\" has unknown permit \"%s\"", s))
+			return
+		}
+	}
+	header := map[string]bool{}
+	for _, permit := range headerPermits {
+		header[permit] = p.IsPermit(permit)
+	}
+	p.ClearPermits()
+	for permit, ok := range header {
+		if ok {
+			p.SetPermit(permit)
+		}
+	}
+	for _, s := range args {
+		group, ok := permitGroups[s]
+		if !ok {
+			group = []string{s}
+		}
+		for _, permit := range group {
+			p.SetPermit(permit)
+		}
+	}
+}
+
+// headerPermits are those of the keywords of the header, before the packages.
+var headerPermits = []string{"projectKw", "useKw", "includeKw"}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
 		}
 	}
+	return false
 }
 
 //--------------------------------------------------------------------------------
 func Propertied(p nodes.GeneralParser) nodes.Expr {
 	if !p.IsPermit("propertied") {
-		p.SyntaxError("\"propertied\" macro disabled but is present")
+		p.PermitError("propertied", "\"propertied\" macro disabled but is present")
 		return nil
 	}
 	return nil //TODO: put logic here
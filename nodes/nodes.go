@@ -74,6 +74,7 @@ type Comment struct {
 type Project struct {
 	Name       string // project name
 	FileExt    string
+	Profile    string // name of the profile FileExt chooses, unless the configuration file or use "profile" gives another
 	Locn       string // absolute path
 	Root       string
 	HasKw      bool
@@ -81,6 +82,7 @@ type Project struct {
 	Doc        []string // doc-comment
 	Pkgs       []*Package
 	ArgImports []*ImportDecl
+	Permits    map[string]bool // in effect at the end of the file
 	node
 }
 
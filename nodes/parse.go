@@ -141,6 +141,9 @@ type PermitParser interface {
 	SetPermit(string)
 	UnsetPermit(string)
 	IsPermit(string) bool
+	ClearPermits()
+	IsPermitName(string) bool
+	PermitError(permit, msg string)
 }
 
 type LineDirectiveParser interface {
@@ -69,7 +69,7 @@ type block struct {
 }
 
 func (ls *labelScope) err(pos src.Pos, format string, args ...interface{}) {
-	ls.errh(Error{pos, fmt.Sprintf(format, args...)})
+	ls.errh(Error{Pos: pos, End: pos, Msg: fmt.Sprintf(format, args...)})
 }
 
 // declare declares the label introduced by s in block b and returns
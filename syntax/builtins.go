@@ -0,0 +1,592 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"sort"
+
+	"github.com/grolang/gro/nodes"
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+// builtinPermits are the permits needed to use the predeclared identifiers
+// whose use doesn't depend on the kind of their argument.
+var builtinPermits = map[string]string{
+	"panic":   "panicAndRecover",
+	"recover": "panicAndRecover",
+	"delete":  "deleteMaps",
+	"append":  "appendCopySlices",
+	"copy":    "appendCopySlices",
+	"close":   "closeChannels",
+	"new":     "newSpecId",
+	"print":   "printSpecIds",
+	"println": "printSpecIds",
+	"complex": "complexRealImagIds",
+	"real":    "complexRealImagIds",
+	"imag":    "complexRealImagIds",
+	"true":    "trueFalseIds",
+	"false":   "trueFalseIds",
+}
+
+// importPermits are the permits needed to import the special packages.
+var importPermits = map[string]string{
+	`"unsafe"`: "unsafePkg",
+	`"C"`:      "cGo",
+}
+
+//--------------------------------------------------------------------------------
+// checkBuiltins checks the uses of the predeclared identifiers in the packages
+// against the permits, calling report with each use of one disabled. Builtins
+// are names rather than syntax, so a use can only be told from one of a user
+// declaration shadowing the builtin once the whole package has been parsed.
+//
+// Whether make, len and cap are permitted depends on whether their argument is
+// a map or a slice. Without type checking that's only known when the argument
+// shows it, as in make(map[string]int) or len(s) where s := []int{1, 2}, and
+// the other uses are let through.
+func checkBuiltins(pkgs []*nodes.Package, permits map[string]bool, report func(pos src.Pos, permit string)) {
+	for _, pkg := range pkgs {
+		r := &resolver{permits: permits, report: report}
+		r.files(pkg.Files)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// LocalNames returns the positions of the names in the Go files that are
+// declared inside a function, and of the uses of those names, which shadow any
+// names declared at the top level of their package.
+func LocalNames(files map[string]*nodes.File) map[src.Pos]bool {
+	locals := map[src.Pos]bool{}
+	var pkgs []*nodes.Package // in order of first file, so the packages are walked in a set order
+	byPkg := map[*nodes.Package][]*nodes.File{}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := files[name]
+		if _, ok := byPkg[f.OwnerPkg]; !ok {
+			pkgs = append(pkgs, f.OwnerPkg)
+		}
+		byPkg[f.OwnerPkg] = append(byPkg[f.OwnerPkg], f)
+	}
+	for _, pkg := range pkgs {
+		r := &resolver{report: func(src.Pos, string) {}, locals: locals}
+		r.files(byPkg[pkg])
+	}
+	return locals
+}
+
+// A resolver walks a package, keeping the scopes of the names declared so it
+// can tell the predeclared identifiers from the names shadowing them.
+type resolver struct {
+	permits map[string]bool
+	report  func(pos src.Pos, permit string)
+	locals  map[src.Pos]bool // if not nil, where the names declared in a function are, and used
+	scope   *scope
+}
+
+type scope struct {
+	parent *scope
+	objs   map[string]*object
+}
+
+// An object is what a name declared in the package refers to.
+type object struct {
+	local  bool // declared inside a function
+	isType bool
+	typ    nodes.Expr // the type of a value or the definition of a type, if known
+	kind   kind       // the kind of a value of unknown type, if its value shows it
+}
+
+// A kind is the little of a type that a builtin needs to know.
+type kind int
+
+const (
+	unknownKind kind = iota
+	sliceKind
+	mapKind
+	otherKind
+)
+
+func (r *resolver) open()  { r.scope = &scope{parent: r.scope, objs: map[string]*object{}} }
+func (r *resolver) close() { r.scope = r.scope.parent }
+
+func (r *resolver) declare(name *nodes.Name, obj *object) {
+	if name != nil && name.Value != "_" {
+		r.scope.objs[name.Value] = obj
+		obj.local = r.scope.parent != nil // not the package scope
+		r.use(name, obj)
+	}
+}
+
+// use records where a name declared inside a function is, if wanted.
+func (r *resolver) use(name *nodes.Name, obj *object) {
+	if r.locals != nil && obj.local {
+		r.locals[name.Pos()] = true
+	}
+}
+
+// lookup returns the object a name refers to, or nil if it's predeclared.
+func (r *resolver) lookup(name string) *object {
+	for s := r.scope; s != nil; s = s.parent {
+		if obj := s.objs[name]; obj != nil {
+			return obj
+		}
+	}
+	return nil
+}
+
+func (r *resolver) check(pos src.Pos, permit string) {
+	if permit != "" && !r.permits[permit] && pos.IsKnown() {
+		r.report(pos, permit)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// files walks the files of a package, once its top-level names are declared.
+func (r *resolver) files(files []*nodes.File) {
+	r.open()
+	for _, f := range files {
+		for _, decl := range f.DeclList {
+			r.declareTop(decl)
+		}
+	}
+	for _, f := range files {
+		for _, imp := range f.InfImports {
+			r.importDecl(imp)
+		}
+		for _, decl := range f.DeclList {
+			r.decl(decl, false)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+// declareTop declares the names of a top-level declaration in the package
+// scope, which they're in throughout the package.
+func (r *resolver) declareTop(decl nodes.Decl) {
+	switch d := decl.(type) {
+	case *nodes.TypeDecl:
+		r.declare(d.Name, &object{isType: true, typ: d.Type})
+	case *nodes.VarDecl:
+		r.declareValues(d.NameList, d.Type, d.Values)
+	case *nodes.ConstDecl:
+		r.declareValues(d.NameList, d.Type, d.Values)
+	case *nodes.FuncDecl:
+		if d.Recv == nil {
+			r.declare(d.Name, &object{typ: d.Type})
+		}
+	}
+}
+
+func (r *resolver) declareValues(names []*nodes.Name, typ nodes.Expr, values nodes.Expr) {
+	vals := exprList(values)
+	for i, name := range names {
+		obj := &object{typ: typ}
+		if typ == nil && len(vals) == len(names) {
+			obj.kind = r.valueKind(vals[i])
+		}
+		r.declare(name, obj)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// decl walks a declaration, declaring its names first if it's local.
+func (r *resolver) decl(decl nodes.Decl, local bool) {
+	switch d := decl.(type) {
+	case *nodes.ImportDecl:
+		r.importDecl(d)
+	case *nodes.TypeDecl:
+		if local {
+			r.declare(d.Name, &object{isType: true, typ: d.Type})
+		}
+		r.expr(d.Type)
+	case *nodes.VarDecl:
+		r.valueDecl(d.NameList, d.Type, d.Values, local)
+	case *nodes.ConstDecl:
+		r.valueDecl(d.NameList, d.Type, d.Values, local)
+	case *nodes.FuncDecl:
+		r.open()
+		if d.Recv != nil {
+			r.field(d.Recv)
+		}
+		r.funcType(d.Type)
+		if d.Body != nil {
+			r.stmtList(d.Body.List)
+		}
+		r.close()
+	}
+}
+
+func (r *resolver) importDecl(d *nodes.ImportDecl) {
+	if d.Path == nil {
+		return
+	}
+	pos := d.Path.Pos()
+	if !pos.IsKnown() && d.LocalPkgName != nil {
+		pos = d.LocalPkgName.Pos() // an in-place import has the position of its use
+	}
+	r.check(pos, importPermits[d.Path.Value])
+}
+
+func (r *resolver) valueDecl(names []*nodes.Name, typ nodes.Expr, values nodes.Expr, local bool) {
+	if typ != nil {
+		r.expr(typ)
+	}
+	if values != nil {
+		r.expr(values)
+	}
+	if local {
+		r.declareValues(names, typ, values)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// funcType declares the parameters and results of a function in the current
+// scope, after walking their types.
+func (r *resolver) funcType(t *nodes.FuncType) {
+	for _, f := range t.ParamList {
+		r.expr(f.Type)
+	}
+	for _, f := range t.ResultList {
+		r.expr(f.Type)
+	}
+	for _, f := range t.ParamList {
+		r.declare(f.Name, &object{typ: f.Type})
+	}
+	for _, f := range t.ResultList {
+		r.declare(f.Name, &object{typ: f.Type})
+	}
+}
+
+func (r *resolver) field(f *nodes.Field) {
+	r.expr(f.Type)
+	r.declare(f.Name, &object{typ: f.Type})
+}
+
+//--------------------------------------------------------------------------------
+func (r *resolver) stmtList(list []nodes.Stmt) {
+	for _, s := range list {
+		r.stmt(s)
+	}
+}
+
+func (r *resolver) block(list []nodes.Stmt) {
+	r.open()
+	r.stmtList(list)
+	r.close()
+}
+
+func (r *resolver) stmt(s nodes.Stmt) {
+	switch s := s.(type) {
+	case nil:
+	case *nodes.LabeledStmt:
+		r.stmt(s.Stmt)
+	case *nodes.BlockStmt:
+		r.block(s.List)
+	case *nodes.ExprStmt:
+		r.expr(s.X)
+	case *nodes.SendStmt:
+		r.expr(s.Chan)
+		r.expr(s.Value)
+	case *nodes.DeclStmt:
+		for _, decl := range s.DeclList {
+			r.decl(decl, true)
+		}
+	case *nodes.AssignStmt:
+		r.assign(s)
+	case *nodes.CallStmt:
+		r.expr(s.Call)
+	case *nodes.ReturnStmt:
+		r.expr(s.Results)
+	case *nodes.IfStmt:
+		r.open()
+		r.stmt(s.Init)
+		r.expr(s.Cond)
+		r.block(s.Then.List)
+		r.stmt(s.Else)
+		r.close()
+	case *nodes.ForStmt:
+		r.open()
+		r.stmt(s.Init)
+		r.expr(s.Cond)
+		r.stmt(s.Post)
+		r.block(s.Body.List)
+		r.close()
+	case *nodes.RangeClause:
+		r.expr(s.X)
+		if s.Def {
+			for _, x := range exprList(s.Lhs) {
+				if name, ok := x.(*nodes.Name); ok {
+					r.declare(name, &object{})
+				}
+			}
+		} else {
+			r.expr(s.Lhs)
+		}
+	case *nodes.SwitchStmt:
+		r.open()
+		r.stmt(s.Init)
+		var guard *nodes.Name
+		if g, ok := s.Tag.(*nodes.TypeSwitchGuard); ok {
+			r.expr(g.X)
+			guard = g.Lhs
+		} else {
+			r.expr(s.Tag)
+		}
+		for _, c := range s.Body {
+			r.open()
+			r.declare(guard, &object{})
+			r.expr(c.Cases)
+			r.stmtList(c.Body)
+			r.close()
+		}
+		r.close()
+	case *nodes.SelectStmt:
+		for _, c := range s.Body {
+			r.open()
+			r.stmt(c.Comm)
+			r.stmtList(c.Body)
+			r.close()
+		}
+	}
+}
+
+// assign walks an assignment, declaring the new variables of a := after
+// walking the values they're given.
+func (r *resolver) assign(s *nodes.AssignStmt) {
+	r.expr(s.Rhs)
+	if s.Op != nodes.Def {
+		r.expr(s.Lhs)
+		return
+	}
+	lhs, rhs := exprList(s.Lhs), exprList(s.Rhs)
+	for i, x := range lhs {
+		name, ok := x.(*nodes.Name)
+		if !ok {
+			r.expr(x)
+			continue
+		}
+		obj := &object{}
+		if len(lhs) == len(rhs) {
+			obj.kind = r.valueKind(rhs[i])
+		}
+		r.declare(name, obj)
+	}
+}
+
+//--------------------------------------------------------------------------------
+func (r *resolver) expr(x nodes.Expr) {
+	switch x := x.(type) {
+	case nil:
+	case *nodes.Name:
+		if obj := r.lookup(x.Value); obj != nil {
+			r.use(x, obj)
+		} else {
+			r.check(x.Pos(), builtinPermits[x.Value])
+		}
+	case *nodes.CompositeLit:
+		r.expr(x.Type)
+		isMap := r.typeKind(x.Type) == mapKind
+		for _, elem := range x.ElemList {
+			if kv, ok := elem.(*nodes.KeyValueExpr); ok {
+				if _, isName := kv.Key.(*nodes.Name); isMap || !isName { // else the key may be a field name
+					r.expr(kv.Key)
+				}
+				r.expr(kv.Value)
+				continue
+			}
+			r.expr(elem)
+		}
+	case *nodes.KeyValueExpr:
+		r.expr(x.Key)
+		r.expr(x.Value)
+	case *nodes.FuncLit:
+		r.open()
+		r.funcType(x.Type)
+		r.stmtList(x.Body.List)
+		r.close()
+	case *nodes.ParenExpr:
+		r.expr(x.X)
+	case *nodes.RhsExpr:
+		r.expr(x.X)
+	case *nodes.SelectorExpr:
+		r.expr(x.X)
+	case *nodes.IndexExpr:
+		r.expr(x.X)
+		r.expr(x.Index)
+	case *nodes.SliceExpr:
+		r.expr(x.X)
+		for _, i := range x.Index {
+			r.expr(i)
+		}
+	case *nodes.AssertExpr:
+		r.expr(x.X)
+		r.expr(x.Type)
+	case *nodes.TypeSwitchGuard:
+		r.expr(x.X)
+	case *nodes.Operation:
+		r.expr(x.X)
+		r.expr(x.Y)
+	case *nodes.CallExpr:
+		r.call(x)
+	case *nodes.ListExpr:
+		for _, elem := range x.ElemList {
+			r.expr(elem)
+		}
+	case *nodes.ArrayType:
+		r.expr(x.Len)
+		r.expr(x.Elem)
+	case *nodes.SliceType:
+		r.expr(x.Elem)
+	case *nodes.DotsType:
+		r.expr(x.Elem)
+	case *nodes.StructType:
+		for _, f := range x.FieldList {
+			r.expr(f.Type)
+		}
+	case *nodes.FuncType:
+		for _, f := range x.ParamList {
+			r.expr(f.Type)
+		}
+		for _, f := range x.ResultList {
+			r.expr(f.Type)
+		}
+	case *nodes.InterfaceType:
+		for _, f := range x.MethodList {
+			r.expr(f.Type)
+		}
+	case *nodes.MapType:
+		r.expr(x.Key)
+		r.expr(x.Value)
+	case *nodes.ChanType:
+		r.expr(x.Elem)
+	}
+}
+
+// call walks a call, checking the builtins whose permit depends on the kind
+// of their argument.
+func (r *resolver) call(x *nodes.CallExpr) {
+	for _, arg := range x.ArgList {
+		r.expr(arg)
+	}
+	name, ok := unwrap(x.Fun).(*nodes.Name)
+	if !ok || r.lookup(name.Value) != nil {
+		r.expr(x.Fun)
+		return
+	}
+	var k kind
+	if len(x.ArgList) > 0 {
+		if name.Value == "make" {
+			k = r.typeKind(x.ArgList[0])
+		} else {
+			k = r.valueKind(x.ArgList[0])
+		}
+	}
+	switch {
+	case name.Value == "make" && k == mapKind:
+		r.check(name.Pos(), "makeMaps")
+	case name.Value == "make" && k == sliceKind:
+		r.check(name.Pos(), "makeSlices")
+	case name.Value == "len" && k == mapKind:
+		r.check(name.Pos(), "lenMaps")
+	case (name.Value == "len" || name.Value == "cap") && k == sliceKind:
+		r.check(name.Pos(), "lenCapSlices")
+	default:
+		r.check(name.Pos(), builtinPermits[name.Value])
+	}
+}
+
+//--------------------------------------------------------------------------------
+// typeKind returns the kind of a type, following the names of those declared
+// in the package to their definitions.
+func (r *resolver) typeKind(t nodes.Expr) kind {
+	for depth := 0; depth < 10; depth++ {
+		switch x := unwrap(t).(type) {
+		case *nodes.SliceType:
+			return sliceKind
+		case *nodes.MapType:
+			return mapKind
+		case *nodes.Name:
+			obj := r.lookup(x.Value)
+			if obj == nil || !obj.isType {
+				return unknownKind
+			}
+			t = obj.typ
+		case nil:
+			return unknownKind
+		default:
+			return otherKind
+		}
+	}
+	return unknownKind
+}
+
+// valueKind returns the kind of the value of an expression, if it shows it.
+func (r *resolver) valueKind(x nodes.Expr) kind {
+	switch x := unwrap(x).(type) {
+	case *nodes.Name:
+		if obj := r.lookup(x.Value); obj != nil && !obj.isType {
+			if obj.typ != nil {
+				return r.typeKind(obj.typ)
+			}
+			return obj.kind
+		}
+	case *nodes.CompositeLit:
+		return r.typeKind(x.Type)
+	case *nodes.CallExpr:
+		name, ok := unwrap(x.Fun).(*nodes.Name)
+		if !ok {
+			return unknownKind
+		}
+		obj := r.lookup(name.Value)
+		switch {
+		case obj == nil && name.Value == "make" && len(x.ArgList) > 0:
+			return r.typeKind(x.ArgList[0])
+		case obj == nil && name.Value == "append":
+			return sliceKind
+		case obj != nil && obj.isType:
+			return r.typeKind(name)
+		}
+	case *nodes.SliceExpr:
+		if r.valueKind(x.X) == sliceKind {
+			return sliceKind
+		}
+	}
+	return unknownKind
+}
+
+//--------------------------------------------------------------------------------
+// unwrap removes the parentheses around an expression, and the marking of it
+// as the right-hand side of a dynamic-mode assignment.
+func unwrap(x nodes.Expr) nodes.Expr {
+	for {
+		switch p := x.(type) {
+		case *nodes.ParenExpr:
+			x = p.X
+		case *nodes.RhsExpr:
+			x = p.X
+		default:
+			return x
+		}
+	}
+}
+
+// exprList returns the expressions of a list, or the one expression.
+func exprList(x nodes.Expr) []nodes.Expr {
+	switch x := unwrap(x).(type) {
+	case nil:
+		return nil
+	case *nodes.ListExpr:
+		return x.ElemList
+	default:
+		return []nodes.Expr{x}
+	}
+}
+
+//================================================================================
@@ -0,0 +1,274 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/grolang/gro/syntax/src"
+)
+
+// ConfigName is the name of the configuration file applying to the Gro files
+// in its directory and those below it, as far down as the next one.
+const ConfigName = "gro.cfg"
+
+//================================================================================
+// A Config holds the settings of a configuration file, which each line of the
+// file gives one of, as a keyword followed by any arguments:
+//
+//	profile g0450              the profile of .gro files, instead of gro
+//	blacklist ifKw gotoKw      permits disabled in every file
+//	output ../gen              the directory the Go files are generated into
+//	linedirectives on          //line directives in the Go files, or off
+//	use dynamic                a use declaration at the top of every file
+//	profiles course.prof       files of user profiles, as ParseProfiles parses
+//
+// Arguments can be quoted, and comments start with //. The blacklist, use and
+// profiles keywords can be given more than once.
+type Config struct {
+	File           string // absolute path, or "" if there's no configuration file
+	Profile        string
+	Blacklist      []string
+	Output         string // absolute path
+	LineDirectives bool
+	Uses           []ConfigUse
+	Profiles       []Profile // user profiles, from the files given by the profiles keyword
+	ProfileFiles   []string  // absolute paths of those files
+}
+
+// A ConfigUse is a use declaration given by a configuration file.
+type ConfigUse struct {
+	Pos  src.Pos
+	Name string
+	Args []string
+}
+
+//--------------------------------------------------------------------------------
+// FindConfig returns the configuration applying to the Gro files in dir, from
+// the nearest configuration file at or above it. If there's none, the Config
+// is empty. An error in the file is returned as an Error.
+func FindConfig(dir string) (*Config, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for d := abs; ; {
+		name := filepath.Join(d, ConfigName)
+		data, err := ioutil.ReadFile(name)
+		switch {
+		case err == nil:
+			return ParseConfig(name, data)
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return &Config{}, nil
+		}
+		d = parent
+	}
+}
+
+//--------------------------------------------------------------------------------
+// ParseConfig parses the contents of the configuration file with the given
+// absolute path.
+func ParseConfig(filename string, data []byte) (*Config, error) {
+	cfg := &Config{File: filename}
+	var profilePos src.Pos
+	err := scanLines(filename, data, func(pos src.Pos, kw string, args []string) error {
+		switch kw {
+		case "profile":
+			if len(args) != 1 || cfg.Profile != "" {
+				return lineError(pos, "profile must be given once, with one argument")
+			}
+			cfg.Profile, profilePos = args[0], pos
+		case "profiles":
+			if len(args) == 0 {
+				return lineError(pos, "missing file after profiles")
+			}
+			for _, arg := range args {
+				name := filepath.Join(filepath.Dir(filename), filepath.FromSlash(arg))
+				data, err := ioutil.ReadFile(name)
+				if err != nil {
+					return lineError(pos, "%s", err)
+				}
+				profs, err := ParseProfiles(name, data, cfg.Profiles)
+				if err != nil {
+					return err
+				}
+				cfg.Profiles = append(cfg.Profiles, profs...)
+				cfg.ProfileFiles = append(cfg.ProfileFiles, name)
+			}
+		case "blacklist":
+			cfg.Blacklist = append(cfg.Blacklist, args...)
+		case "output":
+			if len(args) != 1 || cfg.Output != "" {
+				return lineError(pos, "output must be given once, with one argument")
+			}
+			cfg.Output = filepath.Join(filepath.Dir(filename), filepath.FromSlash(args[0]))
+			if filepath.IsAbs(filepath.FromSlash(args[0])) {
+				cfg.Output = filepath.Clean(filepath.FromSlash(args[0]))
+			}
+		case "linedirectives":
+			if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+				return lineError(pos, "linedirectives must be on or off")
+			}
+			cfg.LineDirectives = args[0] == "on"
+		case "use":
+			if len(args) < 1 {
+				return lineError(pos, "missing name after use")
+			}
+			cfg.Uses = append(cfg.Uses, ConfigUse{Pos: pos, Name: args[0], Args: args[1:]})
+		default:
+			return lineError(pos, "unknown keyword %s", kw)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Profile != "" && FindProfile(cfg.Profile, cfg.Profiles) == nil {
+		return nil, lineError(profilePos, "unknown profile %s", cfg.Profile)
+	}
+	return cfg, nil
+}
+
+//--------------------------------------------------------------------------------
+// ParseProfiles parses the contents of a file of user profiles with the given
+// absolute path. Each profile starts with a line naming it, and the profile it
+// builds on if any, and the lines after it describe it:
+//
+//	profile basics g0070       a profile building on g0070
+//	alias bas                  other extensions choosing it
+//	desc the first weeks       its description
+//	add ifKw elseKw            permits added
+//	remove hexNums             permits of the profile it builds on taken away
+//	use blacklist gotoKw       a use declaration at the top of every file
+//	dynamic                    dynamic typing, as in .groo files
+//	hashcmds                   hash-cmds, as in .grooy files
+//
+// A profile can build on one defined before, in the file or in those already
+// given, the profiles of which are in known.
+func ParseProfiles(filename string, data []byte, known []Profile) ([]Profile, error) {
+	var profs []Profile
+	exists := func(name string) bool {
+		return FindProfile(name, profs) != nil || FindProfile(name, known) != nil
+	}
+	err := scanLines(filename, data, func(pos src.Pos, kw string, args []string) error {
+		if kw == "profile" {
+			if len(args) < 1 || len(args) > 2 {
+				return lineError(pos, "profile must be given a name and at most one profile it builds on")
+			}
+			if exists(args[0]) {
+				return lineError(pos, "profile %s already exists", args[0])
+			}
+			prof := Profile{Name: args[0]}
+			if len(args) == 2 {
+				prof.Parent = args[1]
+				if !exists(prof.Parent) {
+					return lineError(pos, "unknown profile %s", prof.Parent)
+				}
+			}
+			profs = append(profs, prof)
+			return nil
+		}
+		if len(profs) == 0 {
+			return lineError(pos, "%s must follow a profile line", kw)
+		}
+		prof := &profs[len(profs)-1]
+		switch kw {
+		case "alias":
+			for _, alias := range args {
+				if exists(alias) {
+					return lineError(pos, "profile %s already exists", alias)
+				}
+			}
+			prof.Aliases = append(prof.Aliases, args...)
+		case "desc":
+			prof.Desc = strings.Join(args, " ")
+		case "add", "remove":
+			for _, arg := range args {
+				pf, ok := builtinPermit(arg)
+				if !ok {
+					return lineError(pos, "unknown permit %s", arg)
+				}
+				if kw == "add" {
+					prof.Permits = append(prof.Permits, pf)
+				} else {
+					prof.Removes = append(prof.Removes, arg)
+				}
+			}
+		case "use":
+			if len(args) < 1 {
+				return lineError(pos, "missing name after use")
+			}
+			if args[0] == "profile" {
+				return lineError(pos, "a profile can't use another, but can build on it")
+			}
+			prof.Uses = append(prof.Uses, ConfigUse{Pos: pos, Name: args[0], Args: args[1:]})
+		case "dynamic", "hashcmds":
+			if len(args) != 0 {
+				return lineError(pos, "%s takes no arguments", kw)
+			}
+			prof.Dynamic = prof.Dynamic || kw == "dynamic"
+			prof.HashCmds = prof.HashCmds || kw == "hashcmds"
+		default:
+			return lineError(pos, "unknown keyword %s", kw)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profs, nil
+}
+
+//--------------------------------------------------------------------------------
+// scanLines calls f with each line of a configuration or profiles file that
+// isn't blank, its keyword and its arguments, unquoting any that are quoted.
+// Comments start with //.
+func scanLines(filename string, data []byte, f func(pos src.Pos, kw string, args []string) error) error {
+	base := src.NewFileBase(filename, filename)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := uint(1); s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		pos := src.MakePos(base, line, uint(strings.Index(text, fields[0])+1))
+		args := make([]string, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "\"") {
+				uq, err := strconv.Unquote(f)
+				if err != nil {
+					return lineError(pos, "malformed argument %s", f)
+				}
+				f = uq
+			}
+			args = append(args, f)
+		}
+		if err := f(pos, fields[0], args); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+func lineError(pos src.Pos, format string, args ...interface{}) error {
+	return Error{Pos: pos, End: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+//================================================================================
@@ -0,0 +1,122 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+func TestParseConfig(t *testing.T) {
+	name := filepath.Join(string(filepath.Separator)+"proj", ConfigName)
+	cfg, err := ParseConfig(name, []byte(`// settings
+profile g0450
+blacklist ifKw "gotoKw" // quoted
+blacklist forKw
+output ../gen
+linedirectives on
+use dynamic
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := &Config{
+		File:           name,
+		Profile:        "g0450",
+		Blacklist:      []string{"ifKw", "gotoKw", "forKw"},
+		Output:         filepath.Join(string(filepath.Separator), "gen"),
+		LineDirectives: true,
+	}
+	if len(cfg.Uses) != 1 || cfg.Uses[0].Name != "dynamic" || len(cfg.Uses[0].Args) != 0 || cfg.Uses[0].Pos.Line() != 7 {
+		t.Errorf("wrong uses received: %+v", cfg.Uses)
+	}
+	cfg.Uses = nil
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("expected %+v but received %+v", want, cfg)
+	}
+
+	for _, tst := range []struct {
+		src string
+		err string
+	}{
+		{"profile gx\n", "gro.cfg:1:1: unknown profile gx"},
+		{"profile g\nprofile gro\n", "gro.cfg:2:1: profile must be given once, with one argument"},
+		{"\n  linedirectives yes\n", "gro.cfg:2:3: linedirectives must be on or off"},
+		{"use\n", "gro.cfg:1:1: missing name after use"},
+		{"profiles\n", "gro.cfg:1:1: missing file after profiles"},
+		{"output \"gen\n", "gro.cfg:1:1: malformed argument \"gen"},
+		{"outdir gen\n", "gro.cfg:1:1: unknown keyword outdir"},
+	} {
+		_, err := ParseConfig(name, []byte(tst.src))
+		if err == nil || !strings.HasSuffix(err.Error(), tst.err) {
+			t.Errorf("ParseConfig(%q): expected error %q but received %v", tst.src, tst.err, err)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestFindConfig(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tmp, _ = filepath.EvalSymlinks(tmp)
+	dir := filepath.Join(tmp, "abc", "def")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := FindConfig(dir)
+	if err != nil || !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("without configuration file: received %+v, %v", cfg, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, ConfigName), []byte("output gen\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = FindConfig(dir)
+	if err != nil || cfg.File != filepath.Join(tmp, ConfigName) || cfg.Output != filepath.Join(tmp, "gen") {
+		t.Errorf("with configuration file above: received %+v, %v", cfg, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ConfigName), []byte("profile grog\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = FindConfig(dir)
+	if err != nil || cfg.File != filepath.Join(dir, ConfigName) || cfg.Output != "" || cfg.Profile != "grog" {
+		t.Errorf("with nearer configuration file: received %+v, %v", cfg, err)
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestConfigAfterProfile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := ioutil.WriteFile(filepath.Join(tmp, ConfigName), []byte("blacklist gotoKw\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(tmp, "dud.gro")
+	_, err = ParseBytes(fn, src.NewFileBase(fn, fn), []byte(`use "profile"("gro")
+package abc
+func f() {
+	goto end
+end:
+}
+`), nil, nil, 0, nil)
+	if err == nil || !strings.HasSuffix(err.Error(), "dud.gro:4:2: syntax error: goto-statement has been disabled but is present") {
+		t.Errorf("blacklist of configuration file not kept after use \"profile\": received %v", err)
+	}
+}
+
+//================================================================================
@@ -0,0 +1,796 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements formatting of Gro source. Unlike the printer, which
+// emits the Go code generated from a syntax tree, the formatter works on the
+// token stream so each Gro construct, comment, and line break is kept as
+// written and only the indentation and spacing between tokens is changed.
+
+package syntax
+
+import (
+	"bytes"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/grolang/gro/nodes"
+	"github.com/grolang/gro/syntax/src"
+)
+
+//--------------------------------------------------------------------------------
+// Format returns the canonically formatted form of the Gro source text.
+// Indentation follows the brackets and continuation lines, spacing between
+// tokens follows gofmt, and trailing comments, struct fields, grouped const
+// and var specs, and keyed elements are aligned in columns. Formatting is
+// idempotent: formatting its own output returns it unchanged.
+// The filename is only used for position information in any error returned,
+// which is the first lexical error found in text.
+func Format(filename string, text []byte) ([]byte, error) {
+	var f formatter
+	var first error
+	base := src.NewFileBase(filename, filename)
+	f.init(&bytesReader{text}, func(line, col uint, msg string) {
+		if first == nil {
+			pos := src.MakePos(base, line, col)
+			first = Error{Pos: pos, End: pos, Msg: msg}
+		}
+	}, nil)
+	f.dynamicMode = true // accept every escape the scanner knows
+	f.commh = f.addComment
+
+	for f.Next(); f.tok != nodes.EofT; f.Next() {
+		f.addToken()
+	}
+	if first != nil {
+		return nil, first
+	}
+	f.dropSemis()
+	f.setForms()
+	return f.print(f.lines()), nil
+}
+
+//================================================================================
+// operator forms, deciding the spacing around an operator
+const (
+	noForm      = iota
+	spacedForm  // a + b
+	tightForm   // a+b
+	unaryForm   // -a
+	postfixForm // chan<- int
+)
+
+//--------------------------------------------------------------------------------
+// fmtItem is a token or comment in the source being formatted.
+type fmtItem struct {
+	line, col uint        // start position in the source
+	endLine   uint        // line the item ends on
+	endCol    uint        // column just after the item
+	tok       nodes.Token // 0 if the item is a comment
+	nlsemi    bool        // if set, a newline after the item ends the statement
+	text      string      // as printed
+	open      int         // index of the innermost bracket enclosing the item, or -1
+	depth     int         // number of brackets enclosing the item
+	form      int         // spacing form if the item is an operator
+	sep       string      // separator printed before the item if not first on its line
+}
+
+//--------------------------------------------------------------------------------
+// fmtLine is a line of formatted output.
+type fmtLine struct {
+	first, last int  // indexes of the first and last items on the line
+	indent      int  // number of tabs before the first item
+	gap         uint // number of newlines before the line
+	multi       bool // if set, the line is part of an item or list spanning several lines
+}
+
+//--------------------------------------------------------------------------------
+type formatter struct {
+	scanner
+	items []fmtItem
+	keep  map[int]bool // specs keeping an empty type column
+}
+
+//--------------------------------------------------------------------------------
+func (f *formatter) add(line, col uint, tok nodes.Token, text string) {
+	it := fmtItem{line: line, col: col, endLine: line, endCol: col + uint(len(text)), tok: tok, text: text}
+	if n := strings.Count(text, "\n"); n > 0 {
+		it.endLine = line + uint(n)
+		it.endCol = uint(len(text)-strings.LastIndex(text, "\n")) + colbase - 1
+	}
+	f.items = append(f.items, it)
+}
+
+//--------------------------------------------------------------------------------
+func (f *formatter) addComment(line, col uint, text string) {
+	if !strings.HasPrefix(text, "/*") {
+		text = strings.TrimRight(text, " \t\r")
+	}
+	f.add(line, col, 0, text)
+}
+
+//--------------------------------------------------------------------------------
+func (f *formatter) addToken() {
+	var text string
+	switch f.tok {
+	case nodes.SemiT:
+		if f.lit != "semicolon" {
+			return // implied by a newline or EOF
+		}
+		text = ";"
+	case nodes.NameT, nodes.LiteralT:
+		text = f.lit
+	case nodes.OperatorT:
+		text = f.op.String()
+	case nodes.AssignOpT:
+		text = f.op.String() + "="
+	case nodes.IncOpT:
+		text = f.op.String() + f.op.String()
+	default:
+		text = f.tok.String()
+	}
+	if f.hash {
+		text = "#" + text
+	}
+	f.add(f.line, f.col, f.tok, text)
+	f.items[len(f.items)-1].nlsemi = f.nlsemi
+}
+
+//--------------------------------------------------------------------------------
+// dropSemis removes explicit semicolons ending a line where the newline
+// would insert one anyway.
+func (f *formatter) dropSemis() {
+	items := f.items[:0]
+	for i, it := range f.items {
+		if it.tok == nodes.SemiT && len(items) > 0 {
+			prev := items[len(items)-1]
+			j := i + 1
+			for j < len(f.items) && f.items[j].tok == 0 {
+				j++
+			}
+			if prev.tok != 0 && prev.nlsemi && (j == len(f.items) || f.items[j].line > it.line) {
+				continue
+			}
+		}
+		items = append(items, it)
+	}
+	f.items = items
+}
+
+//--------------------------------------------------------------------------------
+// setForms records the enclosing bracket of each item, and decides the
+// spacing form of each operator.
+func (f *formatter) setForms() {
+	var stack []int
+	for i := range f.items {
+		it := &f.items[i]
+		switch it.tok {
+		case nodes.RparenT, nodes.RbrackT, nodes.RbraceT:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		it.open = -1
+		if it.depth = len(stack); it.depth > 0 {
+			it.open = stack[it.depth-1]
+		}
+		switch it.tok {
+		case nodes.LparenT, nodes.LbrackT, nodes.LbraceT:
+			stack = append(stack, i)
+		case nodes.AssignT, nodes.DefineT, nodes.AssignOpT:
+			it.form = spacedForm
+		case nodes.ArrowT:
+			switch {
+			case i > 0 && f.items[i-1].tok == nodes.ChanT:
+				it.form = postfixForm
+			case f.unaryPos(i):
+				it.form = unaryForm
+			default:
+				it.form = spacedForm
+			}
+		case nodes.OperatorT, nodes.StarT:
+			it.form = f.opForm(i)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+func (f *formatter) opForm(i int) int {
+	it := &f.items[i]
+	if it.tok == nodes.OperatorT {
+		switch it.text {
+		case "!":
+			return unaryForm
+		case "||", "&&", "==", "!=", "<", "<=", ">", ">=":
+			return spacedForm
+		}
+	}
+	if f.unaryPos(i) {
+		return unaryForm
+	}
+
+	// an operator that may be binary keeps the spacing it was written with
+	before := f.items[i].col > f.items[i-1].endCol
+	switch {
+	case i+1 == len(f.items) || f.startsLine(i+1):
+		if before {
+			return spacedForm
+		}
+	case f.items[i+1].col > it.endCol:
+		return spacedForm
+	case before:
+		return unaryForm
+	}
+	return tightForm
+}
+
+//--------------------------------------------------------------------------------
+// unaryPos reports whether an operator at item i can only be a unary one.
+func (f *formatter) unaryPos(i int) bool {
+	if i == 0 || f.startsLine(i) {
+		return true
+	}
+	prev := f.items[i-1]
+	switch prev.tok {
+	case 0, nodes.OperatorT, nodes.StarT, nodes.ArrowT, nodes.AssignT, nodes.DefineT, nodes.AssignOpT,
+		nodes.LparenT, nodes.LbrackT, nodes.LbraceT, nodes.CommaT, nodes.SemiT, nodes.ColonT, nodes.DotDotDotT:
+		return true
+	case nodes.RbrackT:
+		return i > 1 && f.items[i-2].tok == nodes.LbrackT // []*T
+	}
+	return prev.tok.IsKeyword()
+}
+
+//--------------------------------------------------------------------------------
+// inHeader reports whether item i is at the bracket level of an if, for,
+// switch, or select keyword earlier on its line, so a brace at i opens a
+// block rather than a composite literal.
+func (f *formatter) inHeader(i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch f.items[j].tok {
+		case nodes.IfT, nodes.ForT, nodes.SwitchT, nodes.SelectT:
+			if f.items[j].depth == f.items[i].depth {
+				return true
+			}
+		}
+		if f.startsLine(j) {
+			break
+		}
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+// pkgParams reports whether the parenthesis at item i opens the parameters
+// of a package or internal package clause.
+func (f *formatter) pkgParams(i int) bool {
+	j := i
+	for !f.startsLine(j) {
+		j--
+	}
+	return f.items[i].depth == 0 &&
+		(f.items[j].tok == nodes.PackageT || f.items[j].tok == nodes.NameT && f.items[j].text == "internal")
+}
+
+//--------------------------------------------------------------------------------
+// elemType reports whether the name at item i ends the element type of a
+// slice, array or map, as in []*pkg.T.
+func (f *formatter) elemType(i int) bool {
+	for i >= 2 && f.items[i-1].tok == nodes.DotT && f.items[i-2].tok == nodes.NameT {
+		i -= 2
+	}
+	for i >= 1 && f.items[i-1].tok == nodes.StarT {
+		i--
+	}
+	return i >= 1 && f.items[i-1].tok == nodes.RbrackT
+}
+
+//--------------------------------------------------------------------------------
+// inSlice reports whether the colon at item i is in a slice expression,
+// where gofmt spaces it only if its operands are spaced.
+func (f *formatter) inSlice(i int) bool {
+	o := f.items[i].open
+	return o >= 0 && f.items[o].tok == nodes.LbrackT
+}
+
+//--------------------------------------------------------------------------------
+// prevToken returns the index of the last token before item i that is not
+// a comment, or -1.
+func (f *formatter) prevToken(i int) int {
+	for i--; i >= 0 && f.items[i].tok == 0; i-- {
+	}
+	return i
+}
+
+//--------------------------------------------------------------------------------
+// funcType reports whether the closing parenthesis at item i ends the
+// parameters of a func type used as an element type, as in []func(){f, g}.
+func (f *formatter) funcType(i int) bool {
+	for k := i - 1; k >= 2; k-- {
+		if f.items[k].tok == nodes.LparenT && f.items[k].depth == f.items[i].depth {
+			if f.items[k-1].tok == nodes.RparenT {
+				return f.funcType(k - 1) // parenthesized results
+			}
+			return f.items[k-1].tok == nodes.FuncT && f.items[k-2].tok == nodes.RbrackT
+		}
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+func (f *formatter) startsLine(i int) bool {
+	return i == 0 || f.items[i].line > f.items[i-1].endLine
+}
+
+//--------------------------------------------------------------------------------
+// lines splits the items into output lines, and works out the indentation
+// of each line: one more than the line holding the innermost open bracket,
+// and one more again for a line continuing an expression from the line
+// before. Lines starting with a closing bracket, a case clause or a label
+// line up with the line holding the bracket.
+func (f *formatter) lines() []fmtLine {
+	var lines []fmtLine
+	var stack []int  // indentation recorded by the open brackets
+	var starts []int // indentation of the last line starting at each depth
+	prevDepth := 0
+	for i := 0; i < len(f.items); {
+		ln := fmtLine{first: i}
+		if i > 0 {
+			ln.gap = f.items[i].line - f.items[i-1].endLine
+			if ln.gap > 2 {
+				ln.gap = 2
+			}
+		}
+
+		base := 0
+		if len(stack) > 0 {
+			base = stack[len(stack)-1] + 1
+		}
+		j := i
+		for j < len(f.items) && isCloser(f.items[j].tok) && (j == i || !f.startsLine(j)) {
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			j++
+		}
+		cont := false
+		switch it := f.items[i]; {
+		case isCloser(it.tok), it.tok == nodes.CaseT, it.tok == nodes.DefaultT, f.beforeCase(i), f.label(i):
+			if base > 0 {
+				ln.indent = base - 1
+			}
+		case i > 0 && len(stack) == prevDepth && f.continues(i):
+			cont = true
+			ln.indent = base + 1
+			lines[len(lines)-1].multi = true
+		default:
+			ln.indent = base
+		}
+		prevDepth = len(stack)
+		if len(starts) > prevDepth {
+			starts = starts[:prevDepth]
+		}
+		for len(starts) <= prevDepth {
+			starts = append(starts, ln.indent)
+		}
+		if cont {
+			starts[prevDepth]--
+		}
+
+		for ; j < len(f.items) && (j == i || !f.startsLine(j)); j++ {
+			it := &f.items[j]
+			switch it.tok {
+			case nodes.LparenT, nodes.LbrackT:
+				stack = append(stack, ln.indent)
+			case nodes.LbraceT:
+				// a block lines up with the start of its header, which may
+				// be on an earlier line
+				if it.depth < len(starts) {
+					stack = append(stack, starts[it.depth])
+				} else {
+					stack = append(stack, starts[len(starts)-1])
+				}
+			case nodes.RparenT, nodes.RbrackT, nodes.RbraceT:
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+			if it.endLine > it.line {
+				ln.multi = true
+			}
+			if j > i {
+				it.sep = " "
+				if !f.spaced(j) {
+					it.sep = ""
+				}
+			}
+		}
+		ln.last = j - 1
+		if len(stack) != prevDepth || isCloser(f.items[i].tok) || cont {
+			ln.multi = true // the line starts or ends a bracketed list spanning lines
+		}
+		lines = append(lines, ln)
+		i = j
+	}
+	for _, ln := range lines {
+		if !ln.multi {
+			f.align(ln)
+		}
+	}
+	return lines
+}
+
+//--------------------------------------------------------------------------------
+func isCloser(tok nodes.Token) bool {
+	return tok == nodes.RparenT || tok == nodes.RbrackT || tok == nodes.RbraceT
+}
+
+//--------------------------------------------------------------------------------
+// continues reports whether the line starting with item i continues an
+// expression, the last token before it being an operator or selector.
+func (f *formatter) continues(i int) bool {
+	j := i - 1
+	for j >= 0 && f.items[j].tok == 0 {
+		j--
+	}
+	if j < 0 || f.items[j].nlsemi {
+		return false
+	}
+	switch f.items[j].tok {
+	case nodes.OperatorT, nodes.StarT, nodes.ArrowT, nodes.AssignT, nodes.DefineT, nodes.AssignOpT, nodes.DotT:
+		return true
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+// label reports whether the line starting with item i holds only a label,
+// which gofmt outdents.
+func (f *formatter) label(i int) bool {
+	if i+1 == len(f.items) || f.items[i].tok != nodes.NameT || f.items[i+1].tok != nodes.ColonT || f.startsLine(i+1) {
+		return false
+	}
+	for j := i + 2; j < len(f.items) && !f.startsLine(j); j++ {
+		if f.items[j].tok != 0 {
+			return false
+		}
+	}
+	o := f.items[i].open
+	return o >= 0 && f.items[o].tok == nodes.LbraceT && !f.compositeLit(o)
+}
+
+//--------------------------------------------------------------------------------
+// beforeCase reports whether item i starts a run of comment lines directly
+// preceding a case clause, and is written no further in than the clause.
+func (f *formatter) beforeCase(i int) bool {
+	j := i
+	for j < len(f.items) && f.items[j].tok == 0 && (j == i || f.startsLine(j)) {
+		j++
+	}
+	if j == i || j == len(f.items) || !f.startsLine(j) {
+		return false
+	}
+	next := f.items[j]
+	return (next.tok == nodes.CaseT || next.tok == nodes.DefaultT) && f.items[i].col <= next.col
+}
+
+//--------------------------------------------------------------------------------
+// align sets the separators on the line which start a new column to the
+// tabs gofmt uses, so the writer aligns them with those on the lines around
+// it. Vertical tabs end a cell which is dropped if its column is empty.
+func (f *formatter) align(ln fmtLine) {
+	last := ln.last
+	for last > ln.first && f.items[last].tok == 0 {
+		last--
+	}
+	first := f.items[ln.first]
+	if first.tok == 0 {
+		return
+	}
+	extra := 0 // number of empty cells before a trailing comment
+	defer func() {
+		if c := &f.items[ln.last]; ln.last > last {
+			c.sep = strings.Repeat("\v", extra)
+			if extra == 0 {
+				c.sep = "\t"
+			}
+		}
+	}()
+	if isCloser(first.tok) {
+		return
+	}
+	o := first.open
+	if o < 0 {
+		if first.tok == nodes.FuncT && f.items[last].tok == nodes.RbraceT {
+			for m := ln.first + 1; m < last; m++ {
+				if f.items[m].tok == nodes.LbraceT && f.items[m].depth == 0 {
+					f.items[m].sep = "\v" // one-line func body
+					break
+				}
+			}
+		}
+		return
+	}
+	p := f.prevToken(o)
+	if p < 0 {
+		return
+	}
+
+	switch {
+	case f.items[o].tok == nodes.LbraceT && f.items[p].tok == nodes.StructT:
+		k := f.names(ln.first, last)
+		named := k >= 0 && f.items[k].tok != nodes.DotT && f.items[k].tok != nodes.LiteralT
+		if named {
+			f.items[k].sep = "\v"
+			extra = 1
+		} else {
+			extra = 2
+		}
+		if t := &f.items[last]; last > ln.first && t.tok == nodes.LiteralT && t.open == o {
+			t.sep = "\v" // tag
+			if named {
+				t.sep = "\v\v"
+			}
+			extra = 0
+		}
+
+	case f.items[o].tok == nodes.LparenT && f.items[p].tok == nodes.TypeT:
+		if ln.first < last {
+			f.items[ln.first+1].sep = "\v"
+		}
+
+	case f.items[o].tok == nodes.LparenT && (f.items[p].tok == nodes.ConstT || f.items[p].tok == nodes.VarT):
+		if f.items[ln.first].tok != nodes.NameT {
+			return
+		}
+		extra = 3
+		k := f.names(ln.first, last)
+		if k < 0 {
+			return
+		}
+		if f.items[k].tok != nodes.AssignT || f.keepType(ln.first) {
+			f.items[k].sep = "\v" // type
+			extra--
+		}
+		for m := k; m <= last; m++ {
+			if f.items[m].tok == nodes.AssignT && f.items[m].open == o {
+				if m == k && extra < 3 {
+					f.items[m].sep = "\v\v" // empty type column
+				} else {
+					f.items[m].sep = "\v"
+				}
+				extra--
+				break
+			}
+		}
+
+	case f.items[o].tok == nodes.LbraceT && f.compositeLit(o):
+		for m := ln.first; m < last; m++ {
+			if f.items[m].tok == nodes.ColonT && f.items[m].open == o {
+				f.items[m+1].sep = "\v" // keyed element
+				break
+			}
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+// keepType reports whether the spec starting at item i keeps an empty type
+// column: as in gofmt, it does if it has values and is in a run of specs
+// with values one of which, at or before it, has a type.
+func (f *formatter) keepType(i int) bool {
+	if f.keep == nil {
+		f.keep = map[int]bool{}
+		for j := range f.items {
+			if f.items[j].tok == nodes.LparenT && j > 0 && (f.items[j-1].tok == nodes.ConstT || f.items[j-1].tok == nodes.VarT) {
+				f.keepTypes(j)
+			}
+		}
+	}
+	return f.keep[i]
+}
+
+//--------------------------------------------------------------------------------
+func (f *formatter) keepTypes(o int) {
+	var run []int
+	keep := false
+	for i := o + 1; i < len(f.items) && f.items[i].depth > f.items[o].depth; i++ {
+		if !f.startsLine(i) || f.items[i].open != o || f.items[i].tok != nodes.NameT {
+			continue
+		}
+		k := f.names(i, len(f.items)-1)
+		typed, valued := k >= 0 && f.items[k].tok != nodes.AssignT, false
+		for m := k; k >= 0 && m < len(f.items) && (m == k || !f.startsLine(m)); m++ {
+			if f.items[m].tok == nodes.AssignT && f.items[m].open == o {
+				valued = true
+			}
+		}
+		if !valued {
+			for _, j := range run {
+				f.keep[j] = keep
+			}
+			run, keep = nil, false
+		} else {
+			run = append(run, i)
+		}
+		keep = keep || typed
+	}
+	for _, j := range run {
+		f.keep[j] = keep
+	}
+}
+
+//--------------------------------------------------------------------------------
+// names returns the index of the item after the comma-separated names
+// starting the line at item i, or -1 if there are none or nothing follows.
+func (f *formatter) names(i, last int) int {
+	if f.items[i].tok != nodes.NameT {
+		return -1
+	}
+	k := i + 1
+	for k+1 <= last && f.items[k].tok == nodes.CommaT && f.items[k+1].tok == nodes.NameT {
+		k += 2
+	}
+	if k > last || f.items[k].tok == 0 || f.items[k].tok == nodes.CommaT {
+		return -1
+	}
+	return k
+}
+
+//--------------------------------------------------------------------------------
+// compositeLit reports whether the brace at item o opens a composite literal
+// rather than a block.
+func (f *formatter) compositeLit(o int) bool {
+	p := f.prevToken(o)
+	if p < 0 {
+		return false
+	}
+	switch f.items[p].tok {
+	case nodes.LbraceT, nodes.RbraceT, nodes.CommaT, nodes.ColonT:
+		return true
+	case nodes.NameT, nodes.RbrackT:
+		for j := p; j >= 0; j-- {
+			switch f.items[j].tok {
+			case nodes.FuncT, nodes.IfT, nodes.ForT, nodes.SwitchT, nodes.SelectT, nodes.ElseT:
+				if f.items[j].depth == f.items[o].depth {
+					return false
+				}
+			}
+			if f.startsLine(j) {
+				return j < p
+			}
+		}
+		return true
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+// print writes the lines, aligning the columns with a tabwriter configured
+// as gofmt does.
+func (f *formatter) print(lines []fmtLine) []byte {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', tabwriter.DiscardEmptyColumns|tabwriter.TabIndent|tabwriter.StripEscape)
+	for n, ln := range lines {
+		if n > 0 {
+			prev := lines[n-1]
+			if ln.gap > 1 || ln.multi || prev.multi || ln.indent != prev.indent {
+				tw.Write([]byte{'\f'}) // end the alignment section
+			} else {
+				tw.Write([]byte{'\n'})
+			}
+			if ln.gap > 1 {
+				tw.Write([]byte{'\n'})
+			}
+		}
+		tw.Write(bytes.Repeat([]byte{'\t'}, ln.indent))
+		for i := ln.first; i <= ln.last; i++ {
+			if i > ln.first {
+				tw.Write([]byte(f.items[i].sep))
+			}
+			tw.Write([]byte{tabwriter.Escape})
+			tw.Write([]byte(f.items[i].text))
+			tw.Write([]byte{tabwriter.Escape})
+		}
+	}
+	if len(lines) > 0 {
+		tw.Write([]byte{'\n'})
+	}
+	tw.Flush()
+	return buf.Bytes()
+}
+
+//--------------------------------------------------------------------------------
+// spaced reports whether a space separates item i from the preceding item
+// on the same line.
+func (f *formatter) spaced(i int) bool {
+	prev, cur := &f.items[i-1], &f.items[i]
+	orig := cur.col > prev.endCol // spaced in the source
+	switch {
+	case cur.tok == 0:
+		return true
+	case prev.tok == 0:
+		return orig
+	}
+
+	switch cur.tok {
+	case nodes.RparenT, nodes.RbrackT, nodes.CommaT, nodes.IncOpT:
+		return false
+	case nodes.SemiT:
+		return prev.tok == nodes.ForT || prev.tok == nodes.SemiT // for ; ; post
+	case nodes.ColonT:
+		return orig && prev.tok != nodes.LbrackT && f.inSlice(i)
+	case nodes.DotT:
+		return prev.tok.IsKeyword() // import . "path"
+	}
+	switch prev.tok {
+	case nodes.LparenT, nodes.LbrackT, nodes.DotDotDotT:
+		return false
+	case nodes.DotT:
+		return cur.tok != nodes.NameT && cur.tok != nodes.LparenT
+	case nodes.CommaT, nodes.SemiT:
+		return true
+	case nodes.ColonT:
+		if f.inSlice(i - 1) {
+			return orig
+		}
+		return true
+	}
+
+	switch prev.form {
+	case spacedForm, postfixForm:
+		return true
+	case tightForm, unaryForm:
+		return false
+	}
+	switch cur.form {
+	case spacedForm:
+		return true
+	case tightForm, postfixForm:
+		return false
+	}
+
+	switch cur.tok {
+	case nodes.LparenT:
+		switch prev.tok {
+		case nodes.NameT:
+			return f.pkgParams(i) // package abc (T)
+		case nodes.RbrackT, nodes.RbraceT:
+			return false
+		case nodes.LiteralT, nodes.RparenT, nodes.FuncT:
+			return orig
+		}
+	case nodes.LbrackT:
+		switch prev.tok {
+		case nodes.NameT, nodes.RparenT:
+			return orig // a field, parameter or result of slice type, or an index
+		case nodes.LiteralT, nodes.RbrackT, nodes.RbraceT, nodes.MapT:
+			return false
+		}
+	case nodes.LbraceT:
+		switch prev.tok {
+		case nodes.RparenT:
+			return !f.funcType(i - 1)
+		case nodes.StructT, nodes.InterfaceT:
+			return i+1 < len(f.items) && f.startsLine(i+1)
+		case nodes.MapT, nodes.FuncT:
+			return false
+		case nodes.NameT:
+			if o := f.items[i-1].open; f.startsLine(i-1) && (o < 0 || f.items[o].tok == nodes.LbraceT && !f.compositeLit(o)) {
+				return true // do {, or a registered statement
+			}
+			return orig || f.inHeader(i) && !f.elemType(i-1)
+		case nodes.RbrackT, nodes.RbraceT:
+			return orig
+		}
+	case nodes.RbraceT, nodes.DotDotDotT:
+		return orig
+	}
+	switch prev.tok {
+	case nodes.LbraceT:
+		return orig
+	case nodes.RbrackT:
+		return cur.tok == nodes.LiteralT && orig
+	}
+	return true
+}
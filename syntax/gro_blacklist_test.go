@@ -5,7 +5,11 @@
 package syntax
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/grolang/gro/syntax/src"
 )
 
 //================================================================================
@@ -704,6 +708,757 @@ func main() {
 		},
 
 		//--------------------------------------------------------------------------------
+		{
+			num: 800,
+			fnm: "dud.g",
+			src: `package main
+func main() {
+	print(010)
+}
+`,
+			err: "dud.g:3:8: syntax error: octal numbers are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 810,
+			fnm: "dud.g",
+			src: `package main
+func main() {
+	print(` + "`" + `hi` + "`" + `)
+}
+`,
+			err: "dud.g:3:8: syntax error: raw strings are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 820,
+			fnm: "dud.g",
+			src: `package main
+func main() {
+	print(1.5, .5)
+}
+`,
+			err: "dud.g:3:13: syntax error: floats with an elided zero, as in 0. or .1, are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 830,
+			fnm: "dud.g",
+			src: `package main
+func main() {
+	print(07.5)
+}
+`,
+			err: "dud.g:3:8: syntax error: floats with a leading zero, as in 072.34, are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 840,
+			fnm: "dud.g",
+			src: `package main
+func main() {
+	print(2i)
+}
+`,
+			err: "dud.g:3:8: syntax error: complex literals are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 850,
+			fnm: "dud.g",
+			src: `package main
+func main() {
+	print("a\101", '\x41', "\u0041", "\U00000041")
+}
+`,
+			err: "dud.g:3:10: syntax error: octal escapes, as in '\\077', are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 860,
+			fnm: "dud.g",
+			src: `package main
+func main() {
+	var π = 3.14
+	print(π)
+}
+`,
+			err: "dud.g:3:6: syntax error: non-ASCII characters in identifier names are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 870,
+			fnm: "dud.g0010",
+			src: `/* a block comment,
+before the profile is known */
+package main
+`,
+			err: "dud.g0010:1:1: syntax error: block comments are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 880,
+			fnm: "dud.gro",
+			src: `use "blacklist"("hexNums", "escapesInStrings")
+package abc
+var s = "a\tb"
+var x = 0x1f
+`,
+			err: "dud.gro:3:11: syntax error: escapes such as '\\n' and '\\t' are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 890,
+			fnm: "dud.go",
+			src: `package abc
+var s = "\e[0m"
+`,
+			err: "dud.go:2:10: syntax error: escape escapes, '\\e', are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		// "\e" escapes become "\x1b" in gro-files
+		{
+			num: 900,
+			fnm: "dud.gro",
+			src: `package abc
+var s = "\e[1m" + ` + "`\\e`" + `
+var r = '\e'
+`,
+			// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+			prt: map[string]string{
+				"dud.go": `package abc
+
+var s = "\x1b[1m" + ` + "`\\e`" + `
+var r = '\x1b'
+`}},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1000,
+			fnm: "dud.gro",
+			src: `use "blacklist"("typeAssertion")
+package abc
+var n = x.(int)
+`,
+			err: "dud.gro:3:10: syntax error: type assertions are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1010,
+			fnm: "dud.gro",
+			src: `use "blacklist"("twoValuedTypeAssertion")
+package abc
+func f() {
+	n, ok := x.(int)
+}
+`,
+			err: "dud.gro:4:12: syntax error: two-valued type assertions, as in v, ok := x.(T), are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1011,
+			fnm: "dud.gro",
+			src: `use "blacklist"("twoValuedTypeAssertion")
+package abc
+var n, ok = x.(int)
+`,
+			err: "dud.gro:3:14: syntax error: two-valued type assertions, as in v, ok := x.(T), are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1012,
+			fnm: "dud.gro",
+			src: `use "blacklist"("twoValuedTypeAssertion")
+package abc
+func f() {
+	var n, ok int = x.(int)
+}
+`,
+			err: "dud.gro:4:19: syntax error: two-valued type assertions, as in v, ok := x.(T), are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1020,
+			fnm: "dud.gro",
+			src: `use "blacklist"("typeSwitchStmt")
+package abc
+func f() {
+	switch x.(type) {
+	}
+}
+`,
+			err: "dud.gro:4:10: syntax error: type switches are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1030,
+			fnm: "dud.gro",
+			src: `use "blacklist"("threeIndexSlices")
+package abc
+var t = s[1:2:3]
+`,
+			err: "dud.gro:3:10: syntax error: slice expressions with 3 indexes, as in a[i:j:k], are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1040,
+			fnm: "dud.gro",
+			src: `use "blacklist"("twoIndexSlices")
+package abc
+var t = s[1:2]
+`,
+			err: "dud.gro:3:10: syntax error: slice expressions with 2 indexes, as in a[i:j], are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1050,
+			fnm: "dud.gro",
+			src: `use "blacklist"("variadicFuncParams")
+package abc
+func f(a ...int) {}
+`,
+			err: "dud.gro:3:10: syntax error: variadic parameters are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1060,
+			fnm: "dud.gro",
+			src: `use "blacklist"("funcLits")
+package abc
+var f = func() {}
+`,
+			err: "dud.gro:3:9: syntax error: function literals are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1070,
+			fnm: "dud.gro",
+			src: `use "blacklist"("structEmbeddedFields")
+package abc
+type T struct {
+	a int
+	U
+}
+`,
+			err: "dud.gro:5:2: syntax error: embedded struct fields are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1080,
+			fnm: "dud.gro",
+			src: `use "blacklist"("structFieldTags")
+package abc
+type T struct {
+	a int "tag"
+}
+`,
+			err: "dud.gro:4:8: syntax error: struct field tags are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1090,
+			fnm: "dud.gro",
+			src: `use "blacklist"("typeAliases")
+package abc
+type T = int
+`,
+			err: "dud.gro:3:8: syntax error: type aliases are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1100,
+			fnm: "dud.gro",
+			src: `use "blacklist"("simpleStmtOnIfStmt")
+package abc
+func f() {
+	if a := g(); a {
+	}
+}
+`,
+			err: "dud.gro:4:7: syntax error: if-statements with an initial simple statement are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1110,
+			fnm: "dud.gro",
+			src: `use "blacklist"("ifElseClause")
+package abc
+func f() {
+	if a {
+	} else if b {
+	}
+}
+`,
+			err: "dud.gro:5:9: syntax error: \"else if\" clauses are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1120,
+			fnm: "dud.gro",
+			src: `use "blacklist"("threeClauseForStmt")
+package abc
+func f() {
+	for i := 0; i < 10; i++ {
+	}
+}
+`,
+			err: "dud.gro:4:2: syntax error: for-statements with 3 clauses are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1130,
+			fnm: "dud.gro",
+			src: `use "blacklist"("blankSwitchStmt")
+package abc
+func f() {
+	switch {
+	}
+}
+`,
+			err: "dud.gro:4:2: syntax error: switch-statements without a tag are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1140,
+			fnm: "dud.gro",
+			src: `use "blacklist"("multiValCases")
+package abc
+func f() {
+	switch a {
+	case 1:
+	case 2, 3:
+	}
+}
+`,
+			err: "dud.gro:6:2: syntax error: case clauses with more than one value are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1150,
+			fnm: "dud.gro",
+			src: `use "blacklist"("methods")
+package abc
+func (t T) f() {}
+`,
+			err: "dud.gro:3:6: syntax error: methods are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1160,
+			fnm: "dud.gro",
+			src: `use "blacklist"("omitRcvrName")
+package abc
+func (T) f() {}
+`,
+			err: "dud.gro:3:7: syntax error: receivers without a name are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		// the cases of a type switch may still list several types
+		{
+			num: 1170,
+			fnm: "dud.gro",
+			src: `use "blacklist"("multiValCases")
+package abc
+func f() {
+	switch x.(type) {
+	case int, string:
+	}
+}
+`,
+			// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+			prt: map[string]string{
+				"dud.go": `package abc
+
+func f() {
+	switch x.(type) {
+	case int, string:
+	}
+}
+`}},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1200,
+			fnm: "dud.gro",
+			src: `use "blacklist"("panicAndRecover")
+package abc
+func f() {
+	defer func() { recover() }()
+	panic("no")
+}
+`,
+			err: "dud.gro:4:17: syntax error: \"panic\" and \"recover\" are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1210,
+			fnm: "dud.gro",
+			src: `use "blacklist"("makeMaps")
+package abc
+var m = make(map[string]int)
+`,
+			err: "dud.gro:3:9: syntax error: \"make\" for maps is disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1220,
+			fnm: "dud.gro",
+			src: `use "blacklist"("makeSlices")
+package abc
+type ints []int
+var s = make(ints, 3)
+`,
+			err: "dud.gro:4:9: syntax error: \"make\" for slices is disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1230,
+			fnm: "dud.gro",
+			src: `use "blacklist"("lenMaps")
+package abc
+func f() int {
+	m := map[string]int{}
+	return len(m)
+}
+`,
+			err: "dud.gro:5:9: syntax error: \"len\" for maps is disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1240,
+			fnm: "dud.gro",
+			src: `use "blacklist"("lenCapSlices")
+package abc
+func f(s []int) int {
+	return len("abc") + cap(s)
+}
+`,
+			err: "dud.gro:4:22: syntax error: \"len\" and \"cap\" for slices are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1250,
+			fnm: "dud.gro",
+			src: `use "blacklist"("deleteMaps")
+package abc
+func f(m map[string]int) {
+	delete(m, "a")
+}
+`,
+			err: "dud.gro:4:2: syntax error: \"delete\" is disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1260,
+			fnm: "dud.gro",
+			src: `use "blacklist"("appendCopySlices")
+package abc
+var s = append([]int{}, 1)
+`,
+			err: "dud.gro:3:9: syntax error: \"append\" and \"copy\" are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1270,
+			fnm: "dud.gro",
+			src: `use "blacklist"("closeChannels")
+package abc
+func f(c chan int) {
+	close(c)
+}
+`,
+			err: "dud.gro:4:2: syntax error: \"close\" is disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1280,
+			fnm: "dud.gro",
+			src: `use "blacklist"("newSpecId")
+package abc
+var p = new(int)
+`,
+			err: "dud.gro:3:9: syntax error: \"new\" is disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1290,
+			fnm: "dud.gro",
+			src: `use "blacklist"("printSpecIds")
+package abc
+func f() {
+	println("hi")
+}
+`,
+			err: "dud.gro:4:2: syntax error: \"print\" and \"println\" are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1300,
+			fnm: "dud.gro",
+			src: `use "blacklist"("complexRealImagIds")
+package abc
+var r = real(c)
+`,
+			err: "dud.gro:3:9: syntax error: \"complex\", \"real\" and \"imag\" are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1310,
+			fnm: "dud.gro",
+			src: `use "blacklist"("trueFalseIds")
+package abc
+var m = map[bool]int{true: 1}
+`,
+			err: "dud.gro:3:22: syntax error: \"true\" and \"false\" are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1320,
+			fnm: "dud.gro",
+			src: `use "blacklist"("unsafePkg")
+package abc
+import "unsafe"
+var n = unsafe.Sizeof(0)
+`,
+			err: "dud.gro:3:8: syntax error: the \"unsafe\" package is disabled but is imported",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1330,
+			fnm: "dud.gro",
+			src: `use "blacklist"("cGo")
+package abc
+import "C"
+`,
+			err: "dud.gro:3:8: syntax error: cgo is disabled but \"C\" is imported",
+		},
+
+		//--------------------------------------------------------------------------------
+		// builtins shadowed by user declarations aren't checked
+		{
+			num: 1340,
+			fnm: "dud.gro",
+			src: `use "blacklist"("panicAndRecover", "lenMaps", "trueFalseIds", "printSpecIds")
+package abc
+type T struct{ true bool }
+var t = T{true: len(m)}
+func f(panic func(string)) {
+	panic("no")
+	println := func() {}
+	println()
+}
+func len(m map[int]int) int { return 0 }
+`,
+			// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+			prt: map[string]string{
+				"dud.go": `package abc
+
+type T struct {
+	true bool
+}
+
+var t = T{
+	true: len(m),
+}
+
+func f(panic func(string)) {
+	panic("no")
+	println := func() {}
+	println()
+}
+
+func len(m map[int]int) int {
+	return 0
+}
+`}},
+
+		//--------------------------------------------------------------------------------
+		// use macro "whitelist"
+		{
+			num: 1400,
+			fnm: "dud.gro",
+			src: `use "whitelist"("package", "funcKw", "if", "printSpecIds", "trueFalseIds")
+package abc
+func f() {
+	if true {
+		println("yes")
+	} else {
+		println("no")
+	}
+}
+`,
+			// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+			prt: map[string]string{
+				"dud.go": `package abc
+
+func f() {
+	if true {
+		println("yes")
+	} else {
+		println("no")
+	}
+}
+`}},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1410,
+			fnm: "dud.gro",
+			src: `use "whitelist"("package", "funcKw", "if")
+package abc
+func f() {
+	for {
+	}
+}
+`,
+			err: "dud.gro:4:2: syntax error: for-statement has been disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1420,
+			fnm: "dud.gro",
+			src: `use "whitelist"("package", "funcKw", "switch", "for")
+package abc
+func f() {
+	for {
+		switch x {
+		case 1:
+			break
+		default:
+			fallthrough
+		}
+	}
+	var y = 0x10
+}
+`,
+			err: "dud.gro:12:10: syntax error: hex numbers are disabled but one is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 1430,
+			fnm: "dud.gro",
+			src: `use "whitelist"("package", "iff")
+package abc
+`,
+			err: "dud.gro:1:34: syntax error: use \"whitelist\" has unknown permit \"iff\"",
+		},
+
+		//--------------------------------------------------------------------------------
+		// a blacklisted feature leaves the keywords another still needs
+		{
+			num: 1440,
+			fnm: "dud.gro",
+			src: `use "blacklist"("switch")
+package abc
+func f() {
+	for {
+		break
+	}
+	switch {
+	}
+}
+`,
+			err: "dud.gro:7:2: syntax error: switch-statement has been disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		// a blacklisted feature disables the keywords it needs by their permits
+		{
+			num: 1450,
+			fnm: "dud.gro",
+			src: `use "blacklist"("package")
+package abc
+`,
+			err: "dud.gro:2:1: syntax error: \"package\" (and similar) keywords are disabled but keyword is present",
+		},
+
+		//--------------------------------------------------------------------------------
+		// a whitelist leaves the header keywords, for the uses after it
+		{
+			num: 1460,
+			fnm: "dud.gro",
+			src: `use "whitelist"("package", "funcKw", "for")
+use "blacklist"("for")
+package abc
+func f() {
+	for {
+	}
+}
+`,
+			err: "dud.gro:5:2: syntax error: for-statement has been disabled but is present",
+		},
+
+		//--------------------------------------------------------------------------------
 
 	})
 }
+
+//================================================================================
+func TestBlacklistAllErrors(t *testing.T) {
+	text := `use "blacklist"("typeAssertion", "panicAndRecover")
+package abc
+var n = x.(int)
+func f() {
+	panic("a")
+	panic("b")
+}
+`
+	var errs []string
+	ParseBytes("dud.gro", src.NewFileBase("dud.gro", "dud.gro"), []byte(text), func(err error) {
+		errs = append(errs, err.Error())
+	}, nil, 0, nil)
+	want := []string{
+		"dud.gro:3:10: syntax error: type assertions are disabled but one is present",
+		"dud.gro:5:2: syntax error: \"panic\" and \"recover\" are disabled but one is present",
+		"dud.gro:6:2: syntax error: \"panic\" and \"recover\" are disabled but one is present",
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("wrong errors received:\n%s", strings.Join(errs, "\n"))
+	}
+}
+
+//================================================================================
@@ -0,0 +1,108 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"fmt"
+	"testing"
+)
+
+//================================================================================
+func TestFormat(t *testing.T) {
+	for _, tst := range []struct {
+		num  int
+		src  string
+		want string //extra field for checking success
+		err  string //extra field for checking failure
+	}{
+		//--------------------------------------------------------------------------------
+		//spacing and indentation
+		{
+			num: 100,
+			src: `package main
+func main(){
+if a:=b + c*d;a>0{
+x[i+1]=y[:n]
+}
+}
+`,
+			want: `package main
+func main() {
+	if a := b + c*d; a > 0 {
+		x[i+1] = y[:n]
+	}
+}
+`},
+
+		//--------------------------------------------------------------------------------
+		//Gro extensions
+		{
+			num: 110,
+			src: `#!/usr/local/go/bin/gro
+project cool
+do{
+"fmt".Println(1+2,[]int{3}) //say it
+}
+`,
+			want: `#!/usr/local/go/bin/gro
+project cool
+do {
+	"fmt".Println(1+2, []int{3}) //say it
+}
+`},
+
+		//--------------------------------------------------------------------------------
+		//alignment of specs, fields and comments
+		{
+			num: 120,
+			src: `package main
+const (
+a=1 //one
+bcd=22 //twenty-two
+)
+type T struct{
+x int
+yz string
+}
+`,
+			want: `package main
+const (
+	a   = 1  //one
+	bcd = 22 //twenty-two
+)
+type T struct {
+	x  int
+	yz string
+}
+`},
+
+		//--------------------------------------------------------------------------------
+		{
+			num: 130,
+			src: "package main\nvar s = \"abc\n",
+			err: "dud.gro:2:13: newline in string"},
+	} {
+		got, err := Format("dud.gro", []byte(tst.src))
+		if tst.err != "" {
+			if err == nil || fmt.Sprintf("%s", err) != tst.err {
+				t.Errorf("Test %d: expected error %q but received: %v", tst.num, tst.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Error received: %s", tst.num, err)
+			continue
+		}
+		if string(got) != tst.want {
+			t.Errorf("Test %d: expected and received source not the same.\n\n#### Expected:\n%s\n\n#### Received:\n%s\n\n",
+				tst.num, tst.want, got)
+		}
+		if again, _ := Format("dud.gro", got); string(again) != string(got) {
+			t.Errorf("Test %d: formatting not idempotent.\n\n#### Received:\n%s\n\n", tst.num, again)
+		}
+	}
+}
+
+//================================================================================
@@ -337,6 +337,82 @@ func run() {
 				"adir/noah/noah.go": `package noah
 `}},
 
+		//--------------------------------------------------------------------------------
+		// file included from several places is parsed once
+		{
+			num: 210,
+			fnm: "dud.gro",
+			src: `include (
+	"mymy"
+	"youyou"
+)
+package def
+`,
+			xtr: map[string]string{
+				"mymy": `include "itit"
+package goa`,
+				"youyou": `include "itit"
+package whoah`,
+				"itit": `package noah`},
+
+			// - - - - - - - - - - - - - - - - - - - -
+			prt: map[string]string{
+				"def/def.go": `package def
+`,
+
+				"goa/goa.go": `package goa
+`,
+
+				"whoah/whoah.go": `package whoah
+`,
+
+				"noah/noah.go": `package noah
+`}},
+
+		//--------------------------------------------------------------------------------
+		// include cycle back to the gro-file
+		{
+			num: 211,
+			fnm: "dud.gro",
+			src: `include "mymy"
+package def
+`,
+			xtr: map[string]string{
+				"mymy": `include "dud.gro"
+package goa`},
+			err: "mymy:1:9: include cycle: dud.gro:1:9 includes mymy, mymy:1:9 includes dud.gro (included from dud.gro:1:9)",
+		},
+
+		//--------------------------------------------------------------------------------
+		// include cycle between included files
+		{
+			num: 212,
+			fnm: "adir/dud.gro",
+			src: `include "mymy"
+package def
+`,
+			xtr: map[string]string{
+				"adir/mymy": `include "sub/itit"
+package goa`,
+				"adir/sub/itit": `include "../mymy"
+package noah`},
+			err: "adir/sub/itit:1:9: include cycle: adir/mymy:1:9 includes adir/sub/itit, adir/sub/itit:1:9 includes adir/mymy (included from adir/mymy:1:9, adir/dud.gro:1:9)",
+		},
+
+		//--------------------------------------------------------------------------------
+		// error in an included file
+		{
+			num: 213,
+			fnm: "dud.gro",
+			src: `include "mymy"
+package def
+`,
+			xtr: map[string]string{
+				"mymy": `package goa
+var = 1`},
+			err: "mymy:2:5: syntax error: unexpected =, expecting name (included from dud.gro:1:9)",
+		},
+
 		//--------------------------------------------------------------------------------
 		// multiple "include" and "use" cmds mixed up
 		{
@@ -0,0 +1,291 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grolang/gro/nodes"
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+// ExpandInclude returns the files an include declaration in a file in dir
+// names, relative to dir and in sorted order. Besides the path of a file, the
+// name can be
+//
+//	"shared/"     every Gro file in the directory
+//	"lib/*.gro"   the files matching a pattern, as path.Match matches them
+//	"**/*.gro"    where ** matches any number of directories, including none
+//
+// Directories starting with . or _, and those named testdata, are passed over
+// by **, as the go command does. A pattern matching no files is an error.
+func ExpandInclude(dir, name string) ([]string, error) {
+	groOnly := strings.HasSuffix(name, "/")
+	pattern := strings.TrimSuffix(name, "/")
+	if groOnly {
+		pattern += "/*"
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{name}, nil
+	}
+
+	segs := strings.Split(pattern, "/")
+	for _, seg := range segs {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, fmt.Errorf("malformed include pattern %q", name)
+		}
+	}
+	fixed := 0 // the segments before the first with a pattern, a directory to start in
+	for fixed < len(segs) && !strings.ContainsAny(segs[fixed], "*?[") {
+		fixed++
+	}
+	prefix := strings.Join(segs[:fixed], "/")
+	start := filepath.Join(dir, filepath.FromSlash(prefix))
+
+	var names []string
+	err := filepath.Walk(start, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			if pth == start && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		rel, err := filepath.Rel(start, pth)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if b := info.Name(); pth != start &&
+				(strings.HasPrefix(b, ".") || strings.HasPrefix(b, "_") || b == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matchSegs(segs[fixed:], strings.Split(rel, "/")) && (!groOnly || isGroFile(rel)) {
+			names = append(names, path.Join(prefix, rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no files match include pattern %q", name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+//--------------------------------------------------------------------------------
+// matchSegs reports whether the segments of a slash-separated path match those
+// of a pattern, in which a ** segment matches any number of segments.
+func matchSegs(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegs(pattern[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segs[0])
+	return ok && matchSegs(pattern[1:], segs[1:])
+}
+
+//--------------------------------------------------------------------------------
+// isGroFile reports whether a file has the extension of one of the profiles.
+func isGroFile(name string) bool {
+	ext := path.Ext(name)
+	return ext != "" && ProfileLevel(ext[1:]) >= 0
+}
+
+//--------------------------------------------------------------------------------
+// An IncludePattern is an include declaration naming files by a pattern, with
+// the files it matched, so a tool can tell when it would match others.
+type IncludePattern struct {
+	Dir   string   // of the file with the declaration, absolute
+	Name  string   // the pattern
+	Files []string // relative to Dir, as ExpandInclude returns them
+}
+
+//================================================================================
+// An IncludeCache holds the files included by the Gro files parsed in a run,
+// so each is read and parsed only once, however many of them include it. It's
+// safe for concurrent use.
+type IncludeCache struct {
+	mu      sync.Mutex
+	files   map[string]*cachedFile    // by output directory, name and path
+	waiting map[*includes]*cachedFile // the file each parse is waiting for
+}
+
+// A cachedFile is an included file parsed, or being parsed, by a Gro file.
+type cachedFile struct {
+	done  chan struct{} // closed when it's been parsed
+	owner *includes     // those of the Gro file parsing it
+	ok    bool          // whether it was parsed without errors
+
+	text string
+	refs []inclRef // its include declarations
+	tree *ownTree  // as parsed, before any Go files are generated from it
+}
+
+// An ownTree holds the packages of an included file, and its imports with
+// arguments, but not those of the files it includes.
+type ownTree struct {
+	Pkgs    []*nodes.Package
+	Imports []*nodes.ImportDecl
+}
+
+// NewIncludeCache returns an empty IncludeCache.
+func NewIncludeCache() *IncludeCache {
+	return &IncludeCache{files: map[string]*cachedFile{}, waiting: map[*includes]*cachedFile{}}
+}
+
+//--------------------------------------------------------------------------------
+// lookup returns the entry for an included file, and whether the parse with
+// the includes is to parse it, finishing the entry if it's returned. If
+// another parse is parsing it, lookup waits for it, unless that parse is
+// waiting on this one. An entry with errors is parsed again, so they're
+// reported for the Gro file including it.
+func (c *IncludeCache) lookup(in *includes, key string) (*cachedFile, bool) {
+	if c == nil {
+		return nil, true
+	}
+	c.mu.Lock()
+	cf := c.files[key]
+	if cf == nil {
+		cf = &cachedFile{done: make(chan struct{}), owner: in}
+		c.files[key] = cf
+		c.mu.Unlock()
+		return cf, true
+	}
+	select {
+	case <-cf.done:
+	default:
+		for owner := cf.owner; owner != nil; {
+			if owner == in {
+				c.mu.Unlock()
+				return nil, true // it would wait for itself
+			}
+			next := c.waiting[owner]
+			if next == nil {
+				break
+			}
+			owner = next.owner
+		}
+		c.waiting[in] = cf
+		c.mu.Unlock()
+		<-cf.done
+		c.mu.Lock()
+		delete(c.waiting, in)
+	}
+	c.mu.Unlock()
+	if !cf.ok {
+		return nil, true
+	}
+	return cf, false
+}
+
+// finish marks an entry as parsed, letting any parses waiting for it go on.
+func (c *IncludeCache) finish(cf *cachedFile, ok bool) {
+	if c == nil || cf == nil {
+		return
+	}
+	c.mu.Lock()
+	cf.ok = ok
+	c.mu.Unlock()
+	close(cf.done)
+}
+
+//--------------------------------------------------------------------------------
+// copyTree returns a deep copy of a syntax tree, as the Go files generated from
+// one change it. Nodes shared within it, such as the group of a declaration,
+// are shared in the copy, but positions and comments, which aren't changed, are
+// shared with the tree.
+func copyTree(x interface{}) interface{} {
+	c := treeCopier{}
+	return c.copy(reflect.ValueOf(x)).Interface()
+}
+
+type treeCopier map[ptrKey]reflect.Value
+
+type ptrKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+var (
+	posBaseType  = reflect.TypeOf(src.PosBase{})
+	commentsType = reflect.TypeOf(nodes.Comments{})
+)
+
+func (c treeCopier) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type().Elem() == posBaseType || v.Type().Elem() == commentsType {
+			return v
+		}
+		key := ptrKey{v.Pointer(), v.Type()}
+		if cp, ok := c[key]; ok {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		c[key] = cp
+		cp.Elem().Set(c.copy(v.Elem()))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(c.copy(v.Elem()))
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v) // for the unexported fields, such as positions
+		for i := 0; i < v.NumField(); i++ {
+			if cp.Field(i).CanSet() {
+				cp.Field(i).Set(c.copy(v.Field(i)))
+			}
+		}
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(c.copy(v.Index(i)))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			cp.SetMapIndex(k, c.copy(v.MapIndex(k)))
+		}
+		return cp
+	}
+	return v
+}
+
+//================================================================================
@@ -0,0 +1,187 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+func TestExpandInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gro-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{
+		"main.gro", "lib/b.gro", "lib/a.gro", "lib/notes.txt", "lib/deep/c.grooy",
+		"shared/d.gro", "shared/e.g", "shared/README", "_old/f.gro", "testdata/g.gro",
+	} {
+		pth := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(pth, []byte("package p\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tst := range []struct {
+		name string
+		want []string
+		err  string
+	}{
+		{"lib/a.gro", []string{"lib/a.gro"}, ""},
+		{"missing.gro", []string{"missing.gro"}, ""}, // left to the include to report
+		{"lib/*.gro", []string{"lib/a.gro", "lib/b.gro"}, ""},
+		{"lib/?.gro", []string{"lib/a.gro", "lib/b.gro"}, ""},
+		{"lib/*", []string{"lib/a.gro", "lib/b.gro", "lib/notes.txt"}, ""},
+		{"shared/", []string{"shared/d.gro", "shared/e.g"}, ""},
+		{"lib/", []string{"lib/a.gro", "lib/b.gro"}, ""},
+		{"**/*.gro", []string{"lib/a.gro", "lib/b.gro", "main.gro", "shared/d.gro"}, ""},
+		{"lib/**/*.gro*", []string{"lib/a.gro", "lib/b.gro", "lib/deep/c.grooy"}, ""},
+		{"_old/*.gro", []string{"_old/f.gro"}, ""},
+		{"empty/", nil, `no files match include pattern "empty/"`},
+		{"lib/*.go", nil, `no files match include pattern "lib/*.go"`},
+		{"lib/[a.gro", nil, `malformed include pattern "lib/[a.gro"`},
+	} {
+		got, err := ExpandInclude(dir, tst.name)
+		if tst.err != "" {
+			if err == nil || err.Error() != tst.err {
+				t.Errorf("ExpandInclude(%q): expected error %q but received %v", tst.name, tst.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tst.want) {
+			t.Errorf("ExpandInclude(%q): expected %v but received %v, %v", tst.name, tst.want, got, err)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestIncludePattern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gro-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main.gro":        "include \"lib/*.gro\"\ninclude \"*.gro\"\npackage main\nfunc main() {}\n",
+		"other.gro":       "package other\n",
+		"lib/b.gro":       "package bee\n",
+		"lib/a.gro":       "include \"../lib/\"\npackage ay\n",
+		"lib/skipped.txt": "not Gro\n",
+	}
+	for name, text := range files {
+		pth := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(pth, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var parsed []string
+	getFile := func(name string) (string, error) {
+		parsed = append(parsed, strings.TrimPrefix(name, filepath.ToSlash(dir)+"/"))
+		text, err := ioutil.ReadFile(name)
+		return string(text), err
+	}
+
+	filename := filepath.Join(dir, "main.gro")
+	proj, err := ParseProject(filename, src.NewFileBase(filename, filename), []byte(files["main.gro"]), nil, getFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []string{"lib/a.gro", "lib/b.gro", "other.gro"}; !reflect.DeepEqual(parsed, want) {
+		t.Errorf("expected files parsed in order %v but received %v", want, parsed)
+	}
+	var pkgs []string
+	for _, pkg := range proj.Pkgs {
+		pkgs = append(pkgs, pkg.Name)
+	}
+	sort.Strings(pkgs)
+	if want := []string{"ay", "bee", "main", "other"}; !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("expected packages %v but received %v", want, pkgs)
+	}
+
+	_, err = ParseBytes(filename, src.NewFileBase(filename, filename), []byte("include \"gen/\"\npackage main\n"), nil, nil, 0, getFile)
+	if want := filename + `:1:9: no files match include pattern "gen/"`; err == nil || err.Error() != want {
+		t.Errorf("expected error %q but received %v", want, err)
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestIncludeCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gro-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"one.gro":   "include \"lib.gro\"\npackage one\n",
+		"two.gro":   "include \"inner.gro\"\ninclude \"lib.gro\"\npackage two\n",
+		"lib.gro":   "include \"inner.gro\"\npackage lib\nfunc Hi() {}\n",
+		"inner.gro": "package inner\nvar (\n\ta = 1\n\tb = 2\n)\n",
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readFile := func(name string) (string, error) {
+		text, err := ioutil.ReadFile(name)
+		return string(text), err
+	}
+	var parsed []string
+	getFile := func(name string) (string, error) {
+		parsed = append(parsed, filepath.Base(name))
+		return readFile(name)
+	}
+
+	//each file included is read once, and generates the same Go files as without the cache
+	cache := NewIncludeCache()
+	for _, name := range []string{"one.gro", "two.gro", "one.gro"} {
+		filename := filepath.Join(dir, name)
+		base := src.NewFileBase(filename, filename)
+		asts, inputs, err := ParseBytesCached(cache, "", filename, base, []byte(files[name]), nil, nil, 0, getFile)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		var included []string
+		for pth := range inputs.Files {
+			included = append(included, filepath.Base(pth))
+		}
+		sort.Strings(included)
+		if want := []string{"inner.gro", "lib.gro"}; !reflect.DeepEqual(included, want) {
+			t.Errorf("%s: expected files included %v but received %v", name, want, included)
+		}
+		want, err := ParseBytes(filename, base, []byte(files[name]), nil, nil, 0, readFile)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if len(asts) != len(want) {
+			t.Errorf("%s: expected %d go files but received %d", name, len(want), len(asts))
+		}
+		for fn, ast := range want {
+			if asts[fn] == nil || StringWithLinebreaks(asts[fn]) != StringWithLinebreaks(ast) {
+				t.Errorf("%s: go file %s differs from that generated without the cache", name, fn)
+			}
+		}
+	}
+	if want := []string{"lib.gro", "inner.gro"}; !reflect.DeepEqual(parsed, want) {
+		t.Errorf("expected files read in order %v but received %v", want, parsed)
+	}
+}
+
+//================================================================================
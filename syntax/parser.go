@@ -7,7 +7,6 @@ package syntax
 import (
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -36,10 +35,12 @@ type parser struct {
 
 	first  error  // first error encountered
 	errcnt int    // number of errors encountered
+	synerr int    // number of those not for a permit disabled
 	pragma Pragma // pragma flags
 
 	fnest  int    // function nesting level (for error handling)
 	xnest  int    // expression nesting level (for complit ambiguity resolution)
+	tswtch bool   // parsing the clauses of a type switch
 	indent []byte // tracing support
 
 	//project, package, and section-level...
@@ -48,12 +49,21 @@ type parser struct {
 	currSect *nodes.File
 
 	getFile        func(string) (string, error) // function for callback to read in another file
+	outDir         string                       // directory the Go files are generated for, if not that of the file
 	docComments    string                       // buffer
 	lineDirectives bool
 
+	incl  *includes // the files included, shared with the parsers of included files
+	refs  []inclRef // the include declarations of the file
+	nincl int       // number of the packages of the project from included files
+	nargs int       // number of the ArgImports of the project from included files
+
 	dynamicBlock string
 	hashCmdBlock bool
 	permits      map[string]bool
+	scanned      []scannedUse // uses of permits scanned before the permits were set up
+	userProfiles []Profile    // those of the configuration file in effect
+	config       *Config      // the configuration file in effect
 	paramdPkgs   map[string]*nodes.Package
 
 	useRegistry  map[string]func([]string, []string)
@@ -89,9 +99,14 @@ func (p *parser) init(
 			}
 		},
 	)
+	p.permith = func(line, col uint, permit string) {
+		p.scannedPermit(p.PosAt(line, col), permit)
+	}
+	p.scanned = nil
 
 	p.first = nil
 	p.errcnt = 0
+	p.synerr = 0
 	p.pragma = 0
 
 	p.fnest = 0
@@ -103,7 +118,23 @@ func (p *parser) init(
 }
 
 //--------------------------------------------------------------------------------
-func (p *parser) ProjFromNewParser(filename string, src []byte) (_ *nodes.Project, first error) {
+func (p *parser) ProjFromNewParser(filename string, src []byte) (*nodes.Project, error) {
+	return p.parseIncluded(filename, filename, src)
+}
+
+//--------------------------------------------------------------------------------
+// parseIncluded parses an included file, with name the filename its positions
+// give. Any errors found are passed to the error handler with the position of
+// the include declaration being parsed added to their trail.
+func (p *parser) parseIncluded(name, filename string, text []byte) (*nodes.Project, error) {
+	return p.subParse(name, filename, text, func(q *parser) *nodes.Project {
+		return q.Proj(filename)
+	})
+}
+
+// subParse runs a parser for an included file, with name the filename its
+// positions give, reporting its errors as parseIncluded does.
+func (p *parser) subParse(name, filename string, text []byte, run func(q *parser) *nodes.Project) (_ *nodes.Project, first error) {
 	defer func() {
 		if pnc := recover(); pnc != nil {
 			if err, ok := pnc.(Error); ok {
@@ -114,10 +145,23 @@ func (p *parser) ProjFromNewParser(filename string, src []byte) (_ *nodes.Projec
 		}
 	}()
 
+	errh := p.errh
+	if decl, ok := p.incl.decl(); ok && errh != nil {
+		errh = func(err error) {
+			if se, ok := err.(Error); ok {
+				se.Trail = append(se.Trail, decl)
+				p.report(se)
+				return
+			}
+			errh(err)
+		}
+	}
 	var q parser
-	q.init(p.base, &bytesReader{src}, p.errh, nil, p.mode, p.getFile)
+	q.init(src.NewFileBase(name, filename), &bytesReader{text}, errh, nil, p.mode, p.getFile)
+	q.outDir = p.outDir
+	q.incl = p.incl
 	q.Next()
-	proj := q.Proj(filename)
+	proj := run(&q)
 	return proj, q.first
 }
 
@@ -125,6 +169,13 @@ func (p *parser) ProjFromNewParser(filename string, src []byte) (_ *nodes.Projec
 func (p *parser) SetPermit(s string)     { p.permits[s] = true }
 func (p *parser) UnsetPermit(s string)   { p.permits[s] = false }
 func (p *parser) IsPermit(s string) bool { return p.permits[s] }
+func (p *parser) ClearPermits()          { p.permits = map[string]bool{} }
+
+// IsPermitName reports whether a permit is one of those of the profiles.
+func (p *parser) IsPermitName(s string) bool {
+	_, ok := builtinPermit(s)
+	return ok
+}
 
 func (p *parser) DynamicBlock() string     { return p.dynamicBlock }
 func (p *parser) SetDynamicBlock(s string) { p.dynamicBlock = s }
@@ -218,7 +269,7 @@ func (p *parser) ProjToFiles(proj *nodes.Project) map[string]*nodes.File {
 	fs := map[string]*nodes.File{}
 	for _, pkg := range proj.Pkgs { // for each file in each pkg, add to map of files returned (fs)
 		if len(proj.Pkgs) > 1 && !p.permits["multiPkg"] {
-			p.SyntaxErrorAt(proj.Pkgs[1].Pos(), permitErrorMsgs["multiPkg"])
+			p.syntaxErrorAt(proj.Pkgs[1].Pos(), "multiPkg", permitErrorMsgs["multiPkg"])
 			return nil
 		}
 		if p.currProj.DirStr != "" {
@@ -389,19 +440,60 @@ func (p *parser) Proj(filename string) (proj *nodes.Project) {
 		p.Error("error computing absolute name for " + filename)
 	}
 	proj.Locn = filepath.ToSlash(absName)
-	firstGoPath := filepath.SplitList(os.Getenv("GOPATH"))[0]
-	srcPath := filepath.ToSlash(filepath.Join(firstGoPath, "src"))
-	proj.Root = strings.TrimPrefix(strings.TrimPrefix(proj.Locn, srcPath), "/")
+	cfg, err := FindConfig(absName)
+	if err != nil {
+		if se, ok := err.(Error); ok {
+			p.ErrorAt(se.Pos, se.Msg)
+		} else {
+			p.Error(fmt.Sprintf("error \"%s\" finding %s for %s", err, ConfigName, filename))
+		}
+		cfg = &Config{} // when the errors are being collected
+	}
+	outDir := absName
+	switch {
+	case p.outDir != "":
+		if outDir, err = filepath.Abs(p.outDir); err != nil {
+			p.Error("error computing absolute name for " + p.outDir)
+		}
+	case cfg.Output != "":
+		outDir = cfg.Output
+	}
+	root, err := FindOutputRoot(outDir)
+	if err != nil {
+		p.Error(fmt.Sprintf("error \"%s\" finding output root for %s", err, filename))
+	}
+	proj.Root = root.ImportPath(outDir)
 	b := filepath.Base(filename)
 	ext := filepath.Ext(b)
 	proj.Name = b[:len(b)-len(ext)]
 	if len(ext) > 0 { // && ext[0] == '.'
 		proj.FileExt = ext[1:]
 	}
+	proj.Profile = proj.FileExt
+	if proj.FileExt == "gro" && cfg.Profile != "" {
+		proj.Profile = cfg.Profile
+	}
+	if prof := FindProfile(proj.Profile, cfg.Profiles); prof != nil {
+		proj.Profile = prof.Name // rather than an alias choosing it
+	}
+
+	if p.incl == nil {
+		p.incl = &includes{}
+	}
+	if p.incl.root == "" {
+		p.incl.root = filepath.ToSlash(filepath.Join(proj.Locn, b))
+		p.incl.parsed, p.incl.texts = map[string]bool{}, map[string]string{}
+	}
 
 	p.currProj = proj
-	p.setupProfile()
+	p.userProfiles, p.config = cfg.Profiles, cfg
 	p.setupRegistries()
+	p.setupProfile()
+	p.applyConfig(cfg)
+	for _, use := range p.scanned {
+		p.scannedPermit(use.pos, use.permit)
+	}
+	p.scanned = nil
 
 	if p.IsName("project") {
 		if !p.checkPermit("projectKw") {
@@ -445,10 +537,26 @@ func (p *parser) Proj(filename string) (proj *nodes.Project) {
 		}
 		p.Want(nodes.SemiT)
 	}
+	nincl := len(pkgs) // those of included files, already checked by their own parsers
+	p.nincl, p.nargs = nincl, len(proj.ArgImports)
 	for p.tok != nodes.EofT {
-		pkgs = append(pkgs, p.PkgOrNil())
+		pos := p.Pos()
+		if pkg := p.PkgOrNil(); pkg != nil {
+			pkgs = append(pkgs, pkg)
+		} else if p.Pos() == pos {
+			p.Advance() // skip a token after an error, so parsing can go on
+		}
 	}
 	proj.Pkgs = pkgs
+	proj.Permits = map[string]bool{}
+	for permit, ok := range p.permits {
+		proj.Permits[permit] = ok
+	}
+	if p.synerr == 0 { // a tree with syntax errors may give spurious ones
+		checkBuiltins(pkgs[nincl:], p.permits, func(pos src.Pos, permit string) {
+			p.errorAt(pos, permit, "syntax error: "+permitErrorMsgs[permit]) // as syntaxErrorAt drops errors at EOF
+		})
+	}
 
 	if !proj.HasKw && len(pkgs) == 0 {
 		p.SyntaxErrorAt(src.MakePos(p.base, 1, 1), "gro-file empty")
@@ -467,27 +575,207 @@ func (p *parser) InclDecl() *nodes.Project {
 		defer p.trace("inclDecl")("")
 	}
 
+	pos := p.Pos()
 	lit := p.OLiteral()
 	if lit == nil {
 		p.SyntaxError("missing name for gro-file after \"include\" keyword")
 		p.Advance(nodes.SemiT, nodes.RparenT)
-		return nil
+		return &nodes.Project{}
 	}
-	fileLocn := filepath.ToSlash(filepath.Join(p.currProj.Locn, strings.Trim(lit.Value, "\"")))
-	src, err := p.getFile(fileLocn)
+	inclName := strings.Trim(lit.Value, "\"")
+	names, err := ExpandInclude(filepath.FromSlash(p.currProj.Locn), inclName)
 	if err != nil {
-		p.Error(fmt.Sprintf("error \"%s\" retrieving included file %s", err, fileLocn))
-		return nil
+		p.ErrorAt(pos, err.Error())
+		return &nodes.Project{}
+	}
+	if len(names) == 1 && names[0] == inclName { // not a pattern
+		return p.include(pos, inclName, nil)
+	}
+	pattern := &IncludePattern{Dir: filepath.FromSlash(p.currProj.Locn), Name: inclName, Files: names}
+	proj := &nodes.Project{}
+	for _, name := range names {
+		proj.Pkgs = append(proj.Pkgs, p.include(pos, name, pattern).Pkgs...)
+	}
+	return proj
+}
+
+//--------------------------------------------------------------------------------
+// include parses a file named by the include declaration at pos, relative to
+// the directory of the file with the declaration, unless it's already been
+// parsed, and returns its project. A file matched by a pattern is passed over
+// if including it would make a cycle.
+func (p *parser) include(pos src.Pos, inclName string, pattern *IncludePattern) *nodes.Project {
+	ref := inclRef{inclStep{
+		pos:  pos,
+		name: filepath.ToSlash(filepath.Join(filepath.Dir(p.base.Pos().Base().Filename()), inclName)),
+		path: filepath.ToSlash(filepath.Join(p.currProj.Locn, inclName)),
+	}, pattern}
+	p.refs = append(p.refs, ref)
+	return p.includeRef(ref)
+}
+
+// includeRef parses the file an include declaration names, as include does.
+func (p *parser) includeRef(ref inclRef) *nodes.Project {
+	pos, name, fileLocn := ref.pos, ref.name, ref.path
+	if ref.pattern != nil {
+		p.incl.addPattern(ref.pattern)
+	}
+	if chain := p.incl.cycle(fileLocn, pos, name); chain != "" {
+		if ref.pattern == nil {
+			p.ErrorAt(pos, "include cycle: "+chain)
+		}
+		return &nodes.Project{} // a pattern includes the other files, not those being parsed
+	}
+	if p.incl.parsed[fileLocn] {
+		return &nodes.Project{} // its packages are in the project already
+	}
+	p.incl.parsed[fileLocn] = true
+
+	cf, parse := p.incl.cache.lookup(p.incl, p.outDir+"\x00"+name+"\x00"+fileLocn)
+	var proj *nodes.Project
+	var err error
+	if parse {
+		proj, err = p.includeFile(ref.inclStep, cf)
+	} else {
+		p.incl.texts[fileLocn] = cf.text
+		p.incl.chain = append(p.incl.chain, ref.inclStep)
+		proj, err = p.replayIncluded(ref.inclStep, cf)
+		p.incl.chain = p.incl.chain[:len(p.incl.chain)-1]
 	}
-	proj, err := p.ProjFromNewParser(fileLocn, []byte(src))
 	if err != nil {
-		p.Error(fmt.Sprintf("error \"%s\" parsing included file %s", err, fileLocn))
-		return nil
+		se, ok := err.(Error)
+		switch {
+		case p.errh != nil: // reported already
+		case ok:
+			se.Trail = append(se.Trail, pos)
+			p.report(se)
+		default:
+			p.Error(fmt.Sprintf("error \"%s\" parsing included file %s", err, fileLocn))
+		}
+		return &nodes.Project{}
+	}
+	if proj == nil {
+		return &nodes.Project{}
 	}
 	p.currProj.ArgImports = append(p.currProj.ArgImports, proj.ArgImports...)
 	return proj
 }
 
+// includeFile reads and parses an included file, recording what it parsed in
+// the cache entry, if there is one, for the other Gro files including it.
+func (p *parser) includeFile(step inclStep, cf *cachedFile) (proj *nodes.Project, err error) {
+	ok := false
+	defer func() { p.incl.cache.finish(cf, ok) }()
+	src, err := p.getFile(step.path)
+	if err != nil {
+		p.Error(fmt.Sprintf("error \"%s\" retrieving included file %s", err, step.path))
+		return nil, nil
+	}
+	p.incl.texts[step.path] = src
+
+	p.incl.chain = append(p.incl.chain, step)
+	proj, err = p.subParse(step.name, step.path, []byte(src), func(q *parser) *nodes.Project {
+		proj := q.Proj(step.path)
+		if proj != nil && q.first == nil && cf != nil {
+			cf.text, cf.refs = src, q.refs
+			cf.tree = copyTree(&ownTree{proj.Pkgs[q.nincl:], proj.ArgImports[q.nargs:]}).(*ownTree)
+			ok = true
+		}
+		return proj
+	})
+	p.incl.chain = p.incl.chain[:len(p.incl.chain)-1]
+	ok = ok && err == nil
+	return proj, err
+}
+
+// replayIncluded returns the project of an included file another Gro file
+// parsed, including the files it includes again, as they may have been
+// included already, or make a cycle, in this one.
+func (p *parser) replayIncluded(step inclStep, cf *cachedFile) (*nodes.Project, error) {
+	return p.subParse(step.name, step.path, nil, func(q *parser) *nodes.Project {
+		q.currProj = &nodes.Project{}
+		var pkgs []*nodes.Package
+		for _, ref := range cf.refs {
+			pkgs = append(pkgs, q.includeRef(ref).Pkgs...)
+		}
+		own := copyTree(cf.tree).(*ownTree)
+		return &nodes.Project{
+			Pkgs:       append(pkgs, own.Pkgs...),
+			ArgImports: append(q.currProj.ArgImports, own.Imports...),
+		}
+	})
+}
+
+//--------------------------------------------------------------------------------
+// includes holds the files included in parsing a Gro file, so each is parsed
+// only once, and the chain of include declarations being parsed, so cycles in
+// it are found.
+type includes struct {
+	root     string            // absolute path of the Gro file
+	parsed   map[string]bool   // absolute paths of the files included
+	texts    map[string]string // the text of each file included, by absolute path
+	patterns []IncludePattern  // the include patterns expanded
+	chain    []inclStep        // the outermost first
+	cache    *IncludeCache     // shared with the parses of other Gro files, if any
+}
+
+// An inclStep is an include declaration being parsed.
+type inclStep struct {
+	pos  src.Pos // of the declaration
+	name string  // of the file included, as its positions give it
+	path string  // absolute path of the file included
+}
+
+// An inclRef is an include declaration of a file, or one of the files its
+// pattern matches.
+type inclRef struct {
+	inclStep
+	pattern *IncludePattern // nil if it names the file itself
+}
+
+// addPattern records an include pattern expanded, unless it's been recorded.
+func (in *includes) addPattern(pattern *IncludePattern) {
+	for _, pt := range in.patterns {
+		if pt.Dir == pattern.Dir && pt.Name == pattern.Name {
+			return
+		}
+	}
+	in.patterns = append(in.patterns, *pattern)
+}
+
+// decl returns the position of the innermost include declaration being parsed,
+// if there is one.
+func (in *includes) decl() (src.Pos, bool) {
+	if in == nil || len(in.chain) == 0 {
+		return src.Pos{}, false
+	}
+	return in.chain[len(in.chain)-1].pos, true
+}
+
+// cycle returns the chain of include declarations leading back to the file
+// with the given path, which a declaration at pos would include, such as
+// "a.gro:1:9 includes b.gro, b.gro:1:9 includes a.gro", or "" if including it
+// doesn't make a cycle.
+func (in *includes) cycle(path string, pos src.Pos, name string) string {
+	start := -1
+	if path == in.root {
+		start = 0
+	}
+	for i, step := range in.chain {
+		if start < 0 && step.path == path {
+			start = i + 1
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+	var links []string
+	for _, step := range append(in.chain[start:], inclStep{pos, name, path}) {
+		links = append(links, fmt.Sprintf("%s includes %s", step.pos, step.name))
+	}
+	return strings.Join(links, ", ")
+}
+
 //--------------------------------------------------------------------------------
 func (p *parser) UseDecl() (proj *nodes.Project) {
 	if trace {
@@ -612,7 +900,9 @@ func (p *parser) PkgOrNil() *nodes.Package {
 		}
 
 		p.currPkg = pkg
-		f = p.SectionOrNil(f)
+		if f = p.SectionOrNil(f); f == nil {
+			return nil
+		}
 		f.FileName = f.PkgName.Value
 
 		// if package without keyword, and main fn defined, use "main" as package-name
@@ -752,6 +1042,7 @@ func (p *parser) SectionOrNil(f *nodes.File) *nodes.File {
 
 	// { TopLevelDecl ";" }
 	for p.tok != nodes.EofT && p.tok != nodes.PackageT && p.tok != nodes.RbraceT && !p.IsName("internal", "section", "main", "testcode") {
+		declPos := p.Pos()
 		switch p.tok {
 		case nodes.ConstT, nodes.VarT, nodes.TypeT, nodes.FuncT: //declarations
 			f.DeclList = p.Decl(f.DeclList)
@@ -766,12 +1057,18 @@ func (p *parser) SectionOrNil(f *nodes.File) *nodes.File {
 				f.DeclList = append(f.DeclList, p.TlBlock())
 			} else {
 				p.SyntaxError(fmt.Sprintf("unexpected %s at top-level", p.tok))
+				p.Advance(nodes.SemiT)
+				p.Got(nodes.SemiT)
 				return nil
 			}
 		}
+		if p.Pos() == declPos {
+			p.Advance() // skip a token after an error, so parsing can go on
+		}
 	}
 	if currPos == p.Pos() && p.tok != nodes.EofT {
 		p.SyntaxError(fmt.Sprintf("unexpected token %s", p.tok))
+		p.Advance() // skip it, so the next package makes progress
 		return nil
 	}
 
@@ -1098,6 +1395,9 @@ func (p *parser) TypeDecl(group *nodes.DeclGroup) nodes.Decl {
 	}
 
 	d.Name = p.Name()
+	if p.tok == nodes.AssignT {
+		p.checkPermit("typeAliases")
+	}
 	d.Alias = p.Got(nodes.AssignT)
 	d.Type = p.TypeOrNil()
 	if d.Type == nil {
@@ -1142,6 +1442,9 @@ func (p *parser) VarDecl(group *nodes.DeclGroup) nodes.Decl {
 			d.Values = p.ExprList(true)
 		}
 	}
+	if len(d.NameList) == 2 && d.Values != nil {
+		p.checkTwoValuedRhs(d.Values)
+	}
 	d.Group = group
 	if len(p.comments) > 0 {
 		if d.Comments() == nil {
@@ -1175,6 +1478,7 @@ func (p *parser) FuncDeclOrNil(stmt func() nodes.Stmt) *nodes.FuncDecl {
 	}
 
 	if p.tok == nodes.LparenT {
+		p.checkPermit("methods")
 		rcvr := p.ParamList()
 		switch len(rcvr) {
 		case 0:
@@ -1184,6 +1488,9 @@ func (p *parser) FuncDeclOrNil(stmt func() nodes.Stmt) *nodes.FuncDecl {
 			fallthrough
 		case 1:
 			f.Recv = rcvr[0]
+			if f.Recv.Name == nil {
+				p.checkPermitAt(f.Recv.Pos(), "omitRcvrName")
+			}
 		}
 	}
 
@@ -1383,14 +1690,26 @@ func (p *parser) TlStmt() nodes.Stmt {
 			}
 		}
 		if mac := p.stmtRegistry[p.lit]; p.tok == nodes.NameT && mac != nil {
-			p.Next()
-			return mac(p, p.TlStmt) //p.tlStmt needed for "let"
+			return p.macroStmt(mac, p.TlStmt) //p.tlStmt needed for "let"
 		}
 	}
 
 	return nil //should never reach
 }
 
+//--------------------------------------------------------------------------------
+// macroStmt parses the use of a statement macro, the current token being its
+// name, giving the statement it expands to the position of the name.
+func (p *parser) macroStmt(mac func(nodes.GeneralParser, ...interface{}) nodes.Stmt, stmt func() nodes.Stmt) nodes.Stmt {
+	pos := p.Pos()
+	p.Next()
+	s := mac(p, stmt)
+	if s != nil && !s.Pos().IsKnown() {
+		s.SetPos(pos)
+	}
+	return s
+}
+
 //--------------------------------------------------------------------------------
 func (p *parser) ProcStmt() nodes.Stmt {
 	if trace {
@@ -1432,8 +1751,7 @@ func (p *parser) ProcStmt() nodes.Stmt {
 			return r
 		}
 	} else if mac := p.stmtRegistry[p.lit]; p.tok == nodes.NameT && mac != nil {
-		p.Next()
-		return mac(p, p.ProcStmt) //p.procStmt needed for "let"
+		return p.macroStmt(mac, p.ProcStmt) //p.procStmt needed for "let"
 	} else if p.tok == nodes.NameT || p.TokIsKeywordName() { //TODO: check label as first if-option
 		pos := p.Pos()
 		lhs := p.ExprList(false)
@@ -1776,7 +2094,9 @@ func (p *parser) SimpleStmt(lhs nodes.Expr, rangeOk bool) nodes.SimpleStmt {
 		}
 
 		// expr_list '=' expr_list
-		return p.NewAssignStmt(pos, 0, lhs, p.ExprList(true))
+		rhs := p.ExprList(true)
+		p.checkTwoValued(lhs, rhs)
+		return p.NewAssignStmt(pos, 0, lhs, rhs)
 
 	case nodes.DefineT:
 		p.Next()
@@ -1808,6 +2128,7 @@ func (p *parser) SimpleStmt(lhs nodes.Expr, rangeOk bool) nodes.SimpleStmt {
 			return s
 		}
 
+		p.checkTwoValued(lhs, rhs)
 		as := p.NewAssignStmt(pos, nodes.Def, lhs, rhs)
 		return as
 
@@ -1825,6 +2146,26 @@ func (p *parser) SimpleStmt(lhs nodes.Expr, rangeOk bool) nodes.SimpleStmt {
 	}
 }
 
+//--------------------------------------------------------------------------------
+// checkTwoValued checks the permit for a two-valued type assertion, if one is
+// being assigned to two variables.
+func (p *parser) checkTwoValued(lhs nodes.Expr, rhs nodes.Expr) {
+	if l, ok := lhs.(*nodes.ListExpr); ok && len(l.ElemList) == 2 {
+		p.checkTwoValuedRhs(rhs)
+	}
+}
+
+// checkTwoValuedRhs checks the permit for a type assertion being assigned to
+// two variables, such as those of a var declaration.
+func (p *parser) checkTwoValuedRhs(rhs nodes.Expr) {
+	if r, ok := rhs.(*nodes.RhsExpr); ok {
+		rhs = r.X
+	}
+	if a, ok := rhs.(*nodes.AssertExpr); ok {
+		p.checkPermitAt(a.Pos(), "twoValuedTypeAssertion")
+	}
+}
+
 //--------------------------------------------------------------------------------
 func (p *parser) NewRangeClause(lhs nodes.Expr, def bool) *nodes.RangeClause {
 	r := new(nodes.RangeClause)
@@ -2060,17 +2401,21 @@ func (p *parser) IfStmt(stmt func() nodes.Stmt) *nodes.IfStmt {
 	}
 	p.CheckHashCmd(p.hash, func() {
 		s.Init, s.Cond, _ = p.header(nodes.IfT)
-		s.Then = p.BlockStmt("if clause", stmt)
-		if !p.checkPermit("elseKw") {
-			p.Advance(nodes.SemiT, nodes.RbraceT)
-			s = nil
-			return
+		if s.Init != nil {
+			p.checkPermitAt(s.Init.Pos(), "simpleStmtOnIfStmt")
 		}
+		s.Then = p.BlockStmt("if clause", stmt)
 		if p.tok == nodes.ElseT {
+			if !p.checkPermit("elseKw") {
+				p.Advance(nodes.SemiT, nodes.RbraceT)
+				s = nil
+				return
+			}
 			p.CheckHashCmd(p.hash, func() {
 				if p.Got(nodes.ElseT) {
 					switch p.tok {
 					case nodes.IfT:
+						p.checkPermit("ifElseClause")
 						s.Else = p.IfStmt(stmt)
 					case nodes.SwitchT:
 						body := new(nodes.BlockStmt)
@@ -2112,6 +2457,7 @@ func (p *parser) IfStmt(stmt func() nodes.Stmt) *nodes.IfStmt {
 
 //--------------------------------------------------------------------------------
 func (p *parser) header(keyword nodes.Token) (init nodes.SimpleStmt, cond nodes.Expr, post nodes.SimpleStmt) {
+	pos := p.Pos()
 	p.Want(keyword)
 
 	if p.tok == nodes.LbraceT {
@@ -2152,6 +2498,7 @@ func (p *parser) header(keyword nodes.Token) (init nodes.SimpleStmt, cond nodes.
 		semi.lit = p.lit
 		p.Next()
 		if keyword == nodes.ForT {
+			p.checkPermitAt(pos, "threeClauseForStmt")
 			if p.tok != nodes.SemiT {
 				if p.tok == nodes.LbraceT {
 					p.SyntaxError("expecting for loop condition")
@@ -2239,14 +2586,21 @@ func (p *parser) SwitchStmt(stmt func() nodes.Stmt) *nodes.SwitchStmt {
 	}
 	p.CheckHashCmd(p.hash, func() {
 		s.Init, s.Tag, _ = p.header(nodes.SwitchT)
+		if s.Tag == nil {
+			p.checkPermitAt(s.Pos(), "blankSwitchStmt")
+		}
 
 		if !p.Got(nodes.LbraceT) {
 			p.SyntaxError("missing { after switch clause")
 			p.Advance(nodes.CaseT, nodes.DefaultT, nodes.RbraceT)
 		}
+		_, isTypeSwitch := s.Tag.(*nodes.TypeSwitchGuard)
+		outer := p.tswtch
+		p.tswtch = isTypeSwitch
 		for p.tok != nodes.EofT && p.tok != nodes.RbraceT {
 			s.Body = append(s.Body, p.CaseClause(stmt))
 		}
+		p.tswtch = outer
 		if len(s.Body) > 0 {
 			s.Body[len(s.Body)-1].Final = true
 		}
@@ -2276,6 +2630,9 @@ func (p *parser) CaseClause(stmt func() nodes.Stmt) *nodes.CaseClause {
 		case nodes.CaseT:
 			p.Next()
 			c.Cases = p.ExprList(true)
+			if _, ok := c.Cases.(*nodes.ListExpr); ok && !p.tswtch {
+				p.checkPermitAt(c.Pos(), "multiValCases")
+			}
 
 		case nodes.DefaultT:
 			p.Next()
@@ -2655,11 +3012,13 @@ loop:
 				case nodes.LparenT:
 					p.Next()
 					if p.Got(nodes.TypeT) {
+						p.checkPermitAt(pos, "typeSwitchStmt")
 						t := new(nodes.TypeSwitchGuard)
 						t.SetPos(pos)
 						t.X = x
 						x = t
 					} else {
+						p.checkPermitAt(pos, "typeAssertion")
 						t := new(nodes.AssertExpr)
 						t.SetPos(pos)
 						t.X = x
@@ -2894,6 +3253,7 @@ func (p *parser) Operand(keep_parens bool) nodes.Expr {
 			if p.tok == nodes.LparenT {
 				t := p.FuncType()
 				if p.tok == nodes.LbraceT {
+					p.checkPermitAt(pos, "funcLits")
 					p.xnest++
 
 					f := new(nodes.FuncLit)
@@ -3081,7 +3441,11 @@ func (p *parser) IndexExpr(x nodes.Expr) nodes.Expr {
 		// x[i:j...
 		t.Index[1] = p.Expr()
 	}
+	if p.tok != nodes.ColonT {
+		p.checkPermitAt(pos, "twoIndexSlices")
+	}
 	if p.Got(nodes.ColonT) {
+		p.checkPermitAt(pos, "threeIndexSlices")
 		t.Full = true
 		// x[i:j:...]
 		if t.Index[1] == nil {
@@ -3547,6 +3911,7 @@ func (p *parser) DotsType() *nodes.DotsType {
 	t := new(nodes.DotsType)
 	t.SetPos(p.Pos())
 
+	p.checkPermit("variadicFuncParams")
 	p.Want(nodes.DotDotDotT)
 	t.Elem = p.TypeOrNil()
 	if t.Elem == nil {
@@ -3635,7 +4000,7 @@ func (p *parser) FieldDecl(styp *nodes.StructType) {
 		if p.tok == nodes.DotT || p.tok == nodes.LiteralT || p.tok == nodes.SemiT || p.tok == nodes.RbraceT {
 			// embed oliteral
 			typ := p.QualifiedName(name)
-			tag := p.OLiteral()
+			tag := p.FieldTag()
 			p.AddField(styp, pos, nil, typ, tag)
 			return
 		}
@@ -3643,7 +4008,7 @@ func (p *parser) FieldDecl(styp *nodes.StructType) {
 		// new_name_list ntype oliteral
 		names := p.NameList(name)
 		typ := p.Type()
-		tag := p.OLiteral()
+		tag := p.FieldTag()
 
 		for _, name := range names {
 			p.AddField(styp, name.Pos(), name, typ, tag)
@@ -3658,7 +4023,7 @@ func (p *parser) FieldDecl(styp *nodes.StructType) {
 				p.Next()
 				typ := newIndirect(pos, p.QualifiedName(nil))
 				p.Want(nodes.RparenT)
-				tag := p.OLiteral()
+				tag := p.FieldTag()
 				p.AddField(styp, pos, nil, typ, tag)
 				p.SyntaxError("cannot parenthesize embedded type")
 
@@ -3666,7 +4031,7 @@ func (p *parser) FieldDecl(styp *nodes.StructType) {
 				// '(' embed ')' oliteral
 				typ := p.QualifiedName(nil)
 				p.Want(nodes.RparenT)
-				tag := p.OLiteral()
+				tag := p.FieldTag()
 				p.AddField(styp, pos, nil, typ, tag)
 				p.SyntaxError("cannot parenthesize embedded type")
 			}
@@ -3677,14 +4042,14 @@ func (p *parser) FieldDecl(styp *nodes.StructType) {
 				// '*' '(' embed ')' oliteral
 				typ := newIndirect(pos, p.QualifiedName(nil))
 				p.Want(nodes.RparenT)
-				tag := p.OLiteral()
+				tag := p.FieldTag()
 				p.AddField(styp, pos, nil, typ, tag)
 				p.SyntaxError("cannot parenthesize embedded type")
 
 			} else {
 				// '*' embed oliteral
 				typ := newIndirect(pos, p.QualifiedName(nil))
-				tag := p.OLiteral()
+				tag := p.FieldTag()
 				p.AddField(styp, pos, nil, typ, tag)
 			}
 
@@ -3695,8 +4060,20 @@ func (p *parser) FieldDecl(styp *nodes.StructType) {
 	}
 }
 
+//--------------------------------------------------------------------------------
+// FieldTag parses the tag of a struct field, if there is one.
+func (p *parser) FieldTag() *nodes.BasicLit {
+	if p.tok == nodes.LiteralT {
+		p.checkPermit("structFieldTags")
+	}
+	return p.OLiteral()
+}
+
 //--------------------------------------------------------------------------------
 func (p *parser) AddField(styp *nodes.StructType, pos src.Pos, name *nodes.Name, typ nodes.Expr, tag *nodes.BasicLit) {
+	if name == nil {
+		p.checkPermitAt(pos, "structEmbeddedFields")
+	}
 	if tag != nil {
 		for i := len(styp.FieldList) - len(styp.TagList); i > 0; i-- {
 			styp.TagList = append(styp.TagList, nil)
@@ -3939,6 +4316,9 @@ func (p *parser) OLiteral() *nodes.BasicLit {
 		b.SetPos(p.Pos())
 		b.Value = p.lit
 		b.Kind = p.kind
+		if b.Kind == nodes.StringLit || b.Kind == nodes.RuneLit {
+			b.Value = expandEscapeEscapes(b.Value)
+		}
 		p.Next()
 		return b
 	}
@@ -4003,11 +4383,30 @@ func (p *parser) PosAt(line, col uint) src.Pos {
 //--------------------------------------------------------------------------------
 // error reports an error at the given position.
 func (p *parser) ErrorAt(pos src.Pos, msg string) {
-	err := Error{pos, msg}
+	p.errorAt(pos, "", msg)
+}
+
+// errorAt reports an error with the given code at the given position. If that's
+// the position of the current token, the error ends where the token does, as
+// long as that's on the same line.
+func (p *parser) errorAt(pos src.Pos, code, msg string) {
+	end := pos
+	if pos == p.Pos() && p.source.line == p.line {
+		end = p.PosAt(p.source.line, p.source.col)
+	}
+	p.report(Error{Pos: pos, End: end, Code: code, Msg: msg})
+}
+
+// report records an error, and passes it to the error handler, or panics with
+// the first error if there's none.
+func (p *parser) report(err Error) {
 	if p.first == nil {
 		p.first = err
 	}
 	p.errcnt++
+	if err.Code == "" {
+		p.synerr++
+	}
 	if p.errh == nil {
 		panic(p.first)
 	}
@@ -4017,6 +4416,16 @@ func (p *parser) ErrorAt(pos src.Pos, msg string) {
 //--------------------------------------------------------------------------------
 // syntax_error_at reports a syntax error at the given position.
 func (p *parser) SyntaxErrorAt(pos src.Pos, msg string) {
+	p.syntaxErrorAt(pos, "", msg)
+}
+
+// PermitError reports a syntax error for the permit being disabled, with the
+// permit as its code.
+func (p *parser) PermitError(permit, msg string) {
+	p.syntaxErrorAt(p.Pos(), permit, msg)
+}
+
+func (p *parser) syntaxErrorAt(pos src.Pos, code, msg string) {
 	if trace {
 		defer p.trace("syntaxError (" + msg + ")")("")
 		//p.print("syntax error: " + msg)
@@ -4036,7 +4445,7 @@ func (p *parser) SyntaxErrorAt(pos src.Pos, msg string) {
 		msg = ", " + msg
 	default:
 		// plain error - we don't care about current token
-		p.ErrorAt(pos, "syntax error: "+msg)
+		p.errorAt(pos, code, "syntax error: "+msg)
 		return
 	}
 
@@ -4058,7 +4467,7 @@ func (p *parser) SyntaxErrorAt(pos src.Pos, msg string) {
 		tok = tokstring(p.tok)
 	}
 
-	p.ErrorAt(pos, "syntax error: unexpected "+tok+msg)
+	p.errorAt(pos, code, "syntax error: unexpected "+tok+msg)
 }
 
 //--------------------------------------------------------------------------------
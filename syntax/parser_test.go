@@ -37,6 +37,7 @@ with no gro_xxxx_test.go where xxxx is:
 	blacklist - TestBlacklist
 	comments - TestComments, TestLineTags, TestNewSyntax
 	divisions - TestDivisions, TestMain, TestCurlies, TestShorthandAliases
+	format - TestFormat
 	generics - TestGenerics
 	initwrap - TestInitwrap, TestWithinProc
 	macros - TestMacros, TestUseDecls, TestDynamic
@@ -121,6 +122,18 @@ func groTest(t *testing.T, groTests groTestData) {
 				t.Error(fmt.Sprintf("Test %d: Expected error: %s;\nbut received: %s", tst.num, tst.err, err))
 				continue
 			}
+			var errs []error
+			func() {
+				defer func() {
+					if pnc := recover(); pnc != nil {
+						t.Errorf("Test %d: panic when reporting all errors: %v", tst.num, pnc)
+					}
+				}()
+				ParseBytes(tst.fnm, src.NewFileBase(tst.fnm, tst.fnm), []byte(tst.src), func(err error) { errs = append(errs, err) }, nil, 0, getFile)
+			}()
+			if len(errs) == 0 || fmt.Sprintf("%s", errs[0]) != tst.err {
+				t.Errorf("Test %d: Expected first of all errors: %s;\nbut received: %v", tst.num, tst.err, errs)
+			}
 			if len(asts) != 0 {
 				t.Error(fmt.Sprintf("Test %d: Expected 0 files from ParsePackage but received %d.\n", tst.num, len(asts)))
 				for fn, ast := range asts {
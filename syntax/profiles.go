@@ -0,0 +1,388 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+// ================================================================================
+// A Permit enables a feature of the language. Those a file has come from its
+// profile, less any disabled by use "blacklist".
+type Permit struct {
+	Name      string
+	Desc      string
+	Unchecked bool // not yet checked by the parser, so blacklisting it has no effect
+}
+
+// A Profile is a level of the language, chosen by the extension of a Gro file.
+// It builds on its parent, adding permits and taking some away.
+type Profile struct {
+	Name     string   // extension choosing it
+	Aliases  []string // other extensions choosing it, "" being that of a file without one
+	Parent   string   // the profile it builds on, or "" if none
+	Desc     string
+	Permits  []Permit    // those it adds over its parent
+	Removes  []string    // those of its parent it takes away
+	Uses     []ConfigUse // use declarations in effect at the top of each file
+	Dynamic  bool        // dynamic typing
+	HashCmds bool        // hash-cmds, which rely on dynamic typing
+}
+
+// --------------------------------------------------------------------------------
+// ProfileLevel returns the index in Profiles of the profile chosen by a file
+// extension, without its dot, or -1 if there's none, in which case the file
+// has no permits.
+func ProfileLevel(ext string) int {
+	for i, prof := range Profiles {
+		if prof.chosenBy(ext) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (prof *Profile) chosenBy(ext string) bool {
+	if prof.Name == ext {
+		return true
+	}
+	for _, alias := range prof.Aliases {
+		if alias == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// FindProfile returns the profile chosen by a file extension, or by a name,
+// among those a user defines and the built-in ones, or nil if there's none.
+func FindProfile(ext string, user []Profile) *Profile {
+	for i := range user {
+		if user[i].chosenBy(ext) {
+			return &user[i]
+		}
+	}
+	if i := ProfileLevel(ext); i >= 0 {
+		return &Profiles[i]
+	}
+	return nil
+}
+
+// ProfileChain returns the profile chosen by a file extension, after those it
+// builds on from the lowest up, or nil if there's no such profile.
+func ProfileChain(ext string, user []Profile) []*Profile {
+	var chain []*Profile
+	for prof := FindProfile(ext, user); prof != nil; prof = FindProfile(prof.Parent, user) {
+		chain = append([]*Profile{prof}, chain...)
+		if prof.Parent == "" {
+			break // rather than look up the profile of files without an extension
+		}
+	}
+	return chain
+}
+
+// ProfilePermits returns the permits a file with the extension starts with,
+// being those of its built-in profile and all it builds on.
+func ProfilePermits(ext string) map[string]bool {
+	return chainPermits(ProfileChain(ext, nil))
+}
+
+// chainPermits returns the permits of the last of a chain of profiles.
+func chainPermits(chain []*Profile) map[string]bool {
+	permits := map[string]bool{}
+	for _, prof := range chain {
+		for _, pf := range prof.Permits {
+			permits[pf.Name] = true
+		}
+		for _, name := range prof.Removes {
+			delete(permits, name)
+		}
+	}
+	return permits
+}
+
+// builtinPermit returns the permit with the name added by one of the built-in
+// profiles, if there's one.
+func builtinPermit(name string) (Permit, bool) {
+	for _, prof := range Profiles {
+		for _, pf := range prof.Permits {
+			if pf.Name == name {
+				return pf, true
+			}
+		}
+	}
+	return Permit{}, false
+}
+
+// --------------------------------------------------------------------------------
+// Profiles are the built-in profiles of the language, from the lowest level
+// up, each building on the one before.
+var Profiles = []Profile{
+	{Name: "g0010", Desc: "enough for a minimal program", Permits: []Permit{
+		{"packageKw", "enable use of the package keyword", false},
+		{"mainPkgAndFunc", "allow package main and func main()", true},
+		{"printSpecIds", "allow print and println spec-ids", false},
+	}},
+	{Name: "g0020", Parent: "g0010", Desc: "non-main functions and packages", Permits: []Permit{
+		{"nonMainFunc", "allow non-main function", true},
+		{"nonMainPkg", "allow non-main package", true},
+	}},
+	{Name: "g0030", Parent: "g0020", Desc: "basic stuff", Permits: []Permit{
+		{"gotoKw", "allow goto-stmts", false},
+		{"blockComments", "otherwise, restricted to line comments only", false},
+		{"exportedIds", "allow exported identifiers - top-level, fields, methods", true},
+		{"initFuncs", "allow init functions", true},
+		{"useLabels", "allow labels", true},
+	}},
+	{Name: "g0040", Parent: "g0030", Desc: "imports", Permits: []Permit{
+		{"importKw", "allow imports", false},
+		{"importGroups", "allow imports in groups", true},
+		{"importAliases", "allow aliases on imports", true},
+		{"unaliasedImports", "allow aliases with default package name", true},
+		{"importBlankAlias", "allow underscore as alias on imports", true},
+		{"importDotAlias", "allow dot as alias on imports", true},
+	}},
+	{Name: "g0050", Parent: "g0040", Desc: "constants", Permits: []Permit{
+		{"constKw", "enable use of the const keyword", false},
+		{"typedConsts", "allow typed constants", true},
+		{"multivaluedConsts", "allow multi-value const declarations", true},
+		{"constGroups", "allow const groups", true},
+		{"iota", "allow iota", true},
+		{"inferedLinesInConstGroup", "allow omitted infered values in const group", true},
+		{"iotaMultiuse", "allow multi-use of iota within a const declaration", true},
+		{"blankConsts", "allow blank constants", true},
+	}},
+	{Name: "g0060", Parent: "g0050", Desc: "variables", Permits: []Permit{
+		{"varKw", "enable use of the var keyword", false},
+		{"typedVars", "allow typed variables", true},
+		{"defaultZeroesForVars", "allow default zero values for variables", true},
+		{"multivalueVarDecls", "allow multi-value var declarations", true},
+		{"varGroups", "allow var groups", true},
+		{"shortVarDecls", "allow short-variable declarations", true},
+		{"blankIdInShortDecls", "allow blank identifier in short-declarations", true},
+		{"multivalueShortDecls", "allow multi-value short declarations", true},
+	}},
+	{Name: "g0070", Parent: "g0060", Desc: "assignments", Permits: []Permit{
+		{"assignments", "allow assignments", true},
+	}},
+	{Name: "g0100", Parent: "g0070", Desc: "integers", Permits: []Permit{
+		{"hexNums", "allow hex", false},
+		{"archDependentInts", "allow int, uint, and uintptr", true},
+		{"sizedInts", "allow int8, int16, int32, int64", true},
+		{"sizedUnsigneds", "allow uint8, uint16, uint32, uint64", true},
+		{"binPlusOp", `allow math/str "+"`, true},
+		{"unaryNumericOps", `allow math u"+", u"-", "-", "*", "/"`, true},
+		{"modOp", `allow integer "%"`, true},
+		{"bitwiseOps", `allow bitwise u"^", "|", "^", "&", "&^"`, true},
+		{"shiftOps", `allow shift "<<", ">>"`, true},
+	}},
+	{Name: "g0110", Parent: "g0100", Desc: "floats", Permits: []Permit{
+		{"standardFloats", "allow standard float notation", true},
+	}},
+	{Name: "g0130", Parent: "g0110", Desc: "booleans", Permits: []Permit{
+		{"trueFalseIds", "allow true and false", false},
+		{"logicalOps", "allow logical ops  !  ||  &&", true},
+		{"equalityOps", "allow equality ops  ==  !=", true},
+		{"comparisonOps", "allow ordering ops  <  <=  >  >=", true},
+	}},
+	{Name: "g0150", Parent: "g0130", Desc: "strings", Permits: []Permit{
+		{"lenOfStrings", "enable len on strings", true},
+		{"hexInStrings", `allow '\x1f' in strings`, false},
+		{"shortUnicodeInStrings", `allow '\uFFe1' in strings`, false},
+		{"longUnicodeInStrings", `allow '\U0001FFFF' in strings`, false},
+		{"escapesInStrings", `allow \a, \b, \f, \n, \r, \t, \v`, false},
+		{"indexStrings", "Indexing: allow index expressions - 1 index", true},
+	}},
+	{Name: "g0160", Parent: "g0150", Desc: "types", Permits: []Permit{
+		{"typeAliases", "allow type aliases", false},
+		{"typeGroups", "allow type groups", true},
+	}},
+	{Name: "g0170", Parent: "g0160", Desc: "structs", Permits: []Permit{
+		{"structKw", "enable use of the struct keyword", false},
+		{"structMultiFieldOfSameType", "allow struct multi-field with same type", true},
+		{"structPadding", "allow struct padding fields", true},
+		{"structSelectors", "allow struct selectors and qualified names", true},
+		{"structComposites", "allow composite struct literals", true},
+	}},
+	{Name: "g0180", Parent: "g0170", Desc: "arrays", Permits: []Permit{
+		{"arrays", "allow arrays", true},
+		{"lenCapArrays", "allow len (and cap) for arrays", true},
+		{"inferredArraySizes", "allow ... in array literals", true},
+	}},
+	{Name: "g0190", Parent: "g0180", Desc: "pointers", Permits: []Permit{
+		{"pointerTypes", "allow pointer types", true},
+		{"newSpecId", "allow pointers with `new(T)`", false},
+		{"addrOfCompositeLit", "allow pointers with `&T{...}`", true},
+		{"unaryIndirection", `allow unary "*"`, true},
+		{"unaryAddressOf", `allow unary "&"`, true},
+	}},
+	{Name: "g0200", Parent: "g0190", Desc: "if stmt", Permits: []Permit{
+		{"ifKw", "enable use of the if keyword", false},
+		{"elseKw", "enable use of the else keyword", false},
+		{"ifElseClause", "allow else-if clause on if stmt", false},
+	}},
+	{Name: "g0210", Parent: "g0200", Desc: "for-while", Permits: []Permit{
+		{"forKw", "enable use of the for keyword", false},
+		{"breakKw", "enable use of the break keyword", false},
+		{"continueKw", "enable use of the continue keyword", false},
+		{"forWhileStmts", "allow for-while stmts", true},
+		{"breakInForStmt", "allow break kw in for stmt; labeled/unlabeled", true},
+		{"continueInForStmt", "allow continue kw in for stmt; labeled/unlabeled", true},
+		{"blankHeadForStmt", "allow empty head in for-while stmt", true},
+		{"threeClauseForStmt", "allow 3-clause for-while stmts", false},
+		{"initInForStmt", "require init in 3-clause for-clause stmts", true},
+		{"postInForStmt", "require post-stmt in 3-clause for-clause stmts", true},
+	}},
+	{Name: "g0450", Aliases: []string{"g"}, Parent: "g0210", Desc: "std subset of go known as g", Permits: []Permit{
+		{"typeKw", "enable use of the type keyword", false},
+		{"returnKw", "enable use of the return keyword", false},
+		{"funcKw", "enable use of the func keyword", false},
+		{"funcDecls", "allow func as declarations", true},
+		{"callExprsAndConverts", "allow call expressions and conversions", true},
+	}},
+	{Name: "g0500", Parent: "g0450", Desc: "not in g", Permits: []Permit{
+		//TODO: also prohibit in: switch x.(type)
+		{"structEmbeddedFields", "allow struct embedded fields", false},
+		{"structPointerFields", "allow pointers to embedded struct fields", true},
+		{"structFieldTags", "allow struct field tags", false},
+		{"simpleStmtOnIfStmt", "allow simple stmt prefix on if stmt", false},
+		{"typeDefns", "allow type definitions", true},
+		{"rangeArrays", "allow for-range stmts on arrays", true},
+		{"rawStringSyntax", "allow raw strings", false},
+		{"octalInStrings", `allow '\077' in strings`, false},
+		{"octalNums", "allow octal", false},
+		{"elidedZeroInFloats", "allow 0. or .1 in floats/complexes", false},
+		{"leadingZeroInFloats", "allow 072.34 in floats", false},
+		{"byteAlias", "allow byte alias", true},
+		{"runeAlias", `allow "rune" alias for int32`, true},
+		{"blankIdInAssigns", "allow blank identifier in assignments", true},
+		{"multivalueAssigns", "allow multi-value assignments", true},
+		{"opAssigns", "allow op-assignments based on permission of op", true},
+		{"incrDecrs", "allow incr/decr stmts", true},
+		{"unicodeInIdNames", "otherwise, restricted to ASCII in identifier names", false},
+		{"cGo", "allow cgo function declarations", false},
+		{"blankLabels", "allow blank labels", true},
+		{"declarePredeclareds", "allow top-level declarations of predeclared special identifiers", true},
+		{"unsafePkg", "allow use of unsafe pkg", false},
+	}},
+	{Name: "g0520", Parent: "g0500", Desc: "complex numbers", Permits: []Permit{
+		{"complexLits", "allow complex lits", false},
+		{"complexRealImagIds", "allow complex, real, and imag", false},
+	}},
+	{Name: "g0610", Parent: "g0520", Desc: "std switch stmt", Permits: []Permit{
+		{"switchKw", "enable use of the switch keyword", false},
+		{"caseKw", "enable use of the case keyword", false},
+		{"defaultKw", "enable use of the default keyword", false},
+		{"fallthroughKw", "enable use of the fallthrough keyword", false},
+		{"blankSwitchStmt", "allow blank expression in std-switch stmt", false},
+		{"simpleStmtPrefixInSwitch", "allow simple stmt prefix on std-switch stmt", true},
+		{"defaultInSwitch", "require default clause in std-switch stmt", true},
+		{"multiValCases", "allow multi-valued case clauses in std-switch stmt", false},
+		{"breakInSwitch", "allow break kw in std-switch stmt", true},
+		{"fallthruInSwitch", "allow fallthrough kw in std-switch stmt", true},
+		{"emptyCaseDefaultInSwitch", "allow empty case/default stmt sequences in std-switch stmt", true},
+	}},
+	{Name: "g0630", Parent: "g0610", Desc: "for-range", Permits: []Permit{
+		{"rangeKw", "enable use of the range keyword", false},
+		{"shortDeclInRanges", "allow short-declaration in for-range stmts", true},
+		{"oneValForRanges", "require at least one value lhs in for-range stmts", true},
+		{"twoValRangesOnly", "require two-value lhs in for-range stmts //except for channels", true},
+	}},
+	{Name: "g0710", Parent: "g0630", Desc: "slices", Permits: []Permit{
+		{"sliceDecls", "allow slice declarations", true},
+		{"lenCapSlices", "allow len, cap for slices", false},
+		{"appendCopySlices", "allow append, copy for slices", false},
+		{"makeSlices", "allow make for slices", false},
+		{"rangeSlices", "allow for-range stmts on slices", true},
+		{"twoIndexSlices", "allow slice expressions with 2 indexes", false},
+		{"threeIndexSlices", "allow slice exprs with 3 indexes", false},
+		{"elideFirstIndexInSlice", "allow elided first index in slice expression with 2 or 3 indexes", true},
+		{"elideSecondIndexInSlice", "allow elided second index in slice expression with 2 indexes", true},
+	}},
+	{Name: "g0720", Parent: "g0710", Desc: "maps", Permits: []Permit{
+		{"mapKw", "enable use of the map keyword", false},
+		{"makeMaps", "allow make on maps", false},
+		{"lenMaps", "enable len on maps", false},
+		{"deleteMaps", "allow delete on maps", false},
+		{"forRangeMaps", "allow for-range stmts for maps", true},
+	}},
+	{Name: "g0730", Parent: "g0720", Desc: "functions", Permits: []Permit{
+		{"deferKw", "enable use of the defer keyword", false},
+		{"goKw", "enable use of the go keyword", false},
+		{"absentFuncParamNames", "allow function type param names to be absent in param lists", true},
+		{"absentFuncResultNames", "allow function type param names to be absent in result lists", true},
+		{"blankFuncResultNames", "allow blank name in param list and/or result list", true},
+		{"variadicFuncParams", "allow variadic param", false},
+		{"funcLits", "allow func literals (with closures)", false},
+		//{"nonterminatingReturn", "allow return as non-terminating stmt in function", true},
+		{"emptyReturnsWhenResults", "disallow empty-valued return stmts when enclosing function has results", true},
+		{"panicAndRecover", "allow panic and recover spec-ids", false},
+		{"variadicArgs", "allow calls with variadic ...", true},
+	}},
+	{Name: "g0740", Parent: "g0730", Desc: "channels", Permits: []Permit{
+		{"selectKw", "enable use of the select keyword", false},
+		{"chanKw", "enable use of the chan keyword", false},
+		{"chanSendStmt", "allow send stmts, i.e. r <- c stmt", true},
+		{"chanReceiveOp", "allow channel receives, i.e. unary <-", true},
+		{"directedChans", "allow directed channels, i.e. both send and receive", true},
+		{"closeChannels", "enable close on channels", false},
+		{"twoValuedReceives", "allow two-valued receive op", true},
+		//{"makeChannels", "allow make on channels", true},
+		//{"lenCapChannels", "allow len, cap on channels", true},
+		{"defaultsInSelectStmt", "require default clause in select stmts", true},
+		{"twoValSelectStmt", "require two-value lhs in select stmts", true},
+		{"emptyCaseDefaultsInSelect", "allow empty case/default stmt sequences in select stmts", true},
+		{"breakKwInSelectStmts", "allow break kw in select stmts; labeled/unlabeled", true},
+		//{"chanForRangeStmt", "allow for-range stmts for channels", true},
+		//{"twoValChanForRangeStmt", "prohibit two-value lhs in for-range stmts for channels", true},
+	}},
+	{Name: "g0750", Parent: "g0740", Desc: "methods", Permits: []Permit{
+		{"methods", "allow defining methods on types", false},
+		{"valueMethodsOnly", "restrict methods to value only", true},
+		{"pointerMethodsOnly", "whether to restrict methods to pointer only", true},
+		{"matchingMethodRcvrTarget", "restrict method set to either all values or all pointers", true},
+		{"omitRcvrName", "allow omitting receiver name", false},
+	}},
+	{Name: "go", Parent: "g0750", Desc: "interfaces, i.e. final layer for exact golang syntax", Permits: []Permit{
+		{"interfaceKw", "enable use of the interface keyword", false},
+		{"embeddedInterface", "allow embedded interfaces", true},
+		{"typeAssertion", "allow type assertions", false},
+		{"twoValuedTypeAssertion", "allow two-valued type assertions", false},
+		{"typeSwitchStmt", "allow type-switch stmt", false},
+		{"simpleStmtOnTypeSwitch", "allow simple stmt prefix on type-switch stmt", true},
+		{"requireDefaultInTypeSwitch", "require default clause in type-switch stmt", true},
+		{"multivaluedCasesInTypeSwitch", "allow multi-valued case clauses in type-switch stmt", true},
+		{"emptyClausesInTypeSwitch", "allow empty case/default stmt sequences in type-switch stmt", true},
+		{"shortDeclInTypeSwitch", "allow short-declaration in type-switch stmt", true},
+		{"breakKwInTypeSwitch", "allow break kw in type-switch stmt; labeled/unlabeled", true},
+	}},
+	{Name: "gro", Aliases: []string{""}, Parent: "go", Desc: "standard grolang extensions", Permits: []Permit{
+		{"assert", `enable "assert" macro`, false},
+		{"let", `enable "let" macro`, false},
+		{"prepare", `enable "prepare" macro`, false},
+		{"execute", `enable "execute" macro`, false},
+		{"run", `enable "run" macro`, false},
+		{"test", `enable "test" macro`, false},
+		{"inferPkg", "enable package names to be inferred", false},
+		{"multiPkg", "enable more than one package in a single file", false},
+		{"inplaceImps", "enable in-place spec strings for package names", false},
+		{"inferMain", "enable main function to be inferred", false},
+		{"pkgSectBlocks", "enable block notation for packages and sections", false},
+		{"projectKw", `enable "project" keyword`, false},
+		{"useKw", `enable "use" keyword`, false},
+		{"includeKw", `enable "include" keyword`, false},
+		{"internalKw", `enable "internal" keyword`, false},
+		{"sectionKw", `enable "section" keyword`, false},
+		{"mainKw", `enable "main" keyword`, false},
+		{"testcodeKw", `enable "testcode" keyword`, false},
+		{"procKw", `enable "proc" keyword`, false},
+		{"doKw", `enable "do" keyword`, false},
+		{"escapeEscapeInStrings", `enable \e in runes/strings`, false},
+	}},
+	{Name: "grog", Parent: "gro", Desc: "generic typing", Permits: []Permit{
+		{"genericCall", "enable imports of generic packages", false},
+		{"genericDef", "enable definitions of generic packages", false},
+	}},
+	{Name: "groo", Parent: "grog", Desc: "dynamic typing", Dynamic: true},
+	{Name: "grooy", Parent: "groo", Desc: "hash-cmds, which rely on dynamic typing", HashCmds: true},
+}
+
+//================================================================================
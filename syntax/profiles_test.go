@@ -0,0 +1,177 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+func TestProfiles(t *testing.T) {
+	seen := map[string]string{}
+	for _, prof := range Profiles {
+		for _, pf := range prof.Permits {
+			if other, ok := seen[pf.Name]; ok {
+				t.Errorf("permit %s added by both %s and %s", pf.Name, other, prof.Name)
+			}
+			seen[pf.Name] = prof.Name
+		}
+	}
+
+	for _, tst := range []struct {
+		ext   string
+		level string
+		has   []string
+		lacks []string
+	}{
+		{"g0010", "g0010", []string{"packageKw"}, []string{"gotoKw", "ifKw"}},
+		{"g0210", "g0210", []string{"packageKw", "ifKw", "forKw"}, []string{"typeKw", "useKw"}},
+		{"g", "g0450", []string{"ifKw", "typeKw"}, []string{"rangeKw"}},
+		{"", "gro", []string{"useKw", "interfaceKw", "packageKw"}, []string{"genericDef"}},
+		{"grooy", "grooy", []string{"useKw", "genericDef"}, nil},
+	} {
+		level := ProfileLevel(tst.ext)
+		if level < 0 || Profiles[level].Name != tst.level {
+			t.Errorf("ProfileLevel(%q): expected profile %s but received level %d", tst.ext, tst.level, level)
+			continue
+		}
+		permits := ProfilePermits(tst.ext)
+		for _, permit := range tst.has {
+			if !permits[permit] {
+				t.Errorf("ProfilePermits(%q): permit %s missing", tst.ext, permit)
+			}
+		}
+		for _, permit := range tst.lacks {
+			if permits[permit] {
+				t.Errorf("ProfilePermits(%q): unexpected permit %s", tst.ext, permit)
+			}
+		}
+	}
+
+	if level, permits := ProfileLevel("txt"), ProfilePermits("txt"); level != -1 || len(permits) != 0 {
+		t.Errorf("unknown extension: expected no profile but received level %d with permits %v", level, permits)
+	}
+
+	for i, prof := range Profiles {
+		if i > 0 && prof.Parent != Profiles[i-1].Name {
+			t.Errorf("profile %s builds on %q rather than on %s, the one before", prof.Name, prof.Parent, Profiles[i-1].Name)
+		}
+	}
+	if chain := ProfileChain("g", nil); len(chain) != ProfileLevel("g")+1 || chain[0].Name != "g0010" || chain[len(chain)-1].Name != "g0450" {
+		t.Errorf("ProfileChain(\"g\"): received %d profiles", len(chain))
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestParseProfiles(t *testing.T) {
+	known := []Profile{{Name: "older", Parent: "g0010", Permits: []Permit{{Name: "ifKw"}}}}
+	profs, err := ParseProfiles("/proj/course.prof", []byte(`// levels of the course
+profile basics g0100 // building on a built-in profile
+alias bas
+desc the first "weeks"
+add ifKw elseKw
+remove hexNums
+
+profile scripting basics
+use linedirectives
+dynamic
+
+profile more older
+`), known)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(profs) != 3 || profs[0].Name != "basics" || profs[1].Parent != "basics" || profs[2].Parent != "older" {
+		t.Fatalf("wrong profiles received: %+v", profs)
+	}
+	if p := profs[0]; !reflect.DeepEqual(p.Aliases, []string{"bas"}) || p.Desc != "the first weeks" ||
+		len(p.Permits) != 2 || p.Permits[1].Name != "elseKw" || !reflect.DeepEqual(p.Removes, []string{"hexNums"}) {
+		t.Errorf("wrong profile received: %+v", p)
+	}
+	if p := profs[1]; len(p.Uses) != 1 || p.Uses[0].Name != "linedirectives" || p.Uses[0].Pos.Line() != 9 || !p.Dynamic || p.HashCmds {
+		t.Errorf("wrong profile received: %+v", p)
+	}
+
+	all := append(known, profs...)
+	permits := chainPermits(ProfileChain("scripting", all))
+	if !permits["ifKw"] || !permits["elseKw"] || permits["hexNums"] || permits["forKw"] {
+		t.Errorf("wrong permits for scripting: %v", permits)
+	}
+	if !ProfilePermits("g0100")["hexNums"] || permits["hexNums"] {
+		t.Errorf("hexNums should be removed from scripting but not from g0100")
+	}
+	if chain := ProfileChain("bas", all); len(chain) != ProfileLevel("g0100")+2 || chain[len(chain)-1].Name != "basics" {
+		t.Errorf("ProfileChain(\"bas\"): received %d profiles", len(chain))
+	}
+
+	for _, tst := range []struct {
+		src string
+		err string
+	}{
+		{"add ifKw\n", "course.prof:1:1: add must follow a profile line"},
+		{"profile\n", "course.prof:1:1: profile must be given a name and at most one profile it builds on"},
+		{"profile gro\n", "course.prof:1:1: profile gro already exists"},
+		{"profile a\nprofile b\nalias a\n", "course.prof:3:1: profile a already exists"},
+		{"profile x older\nprofile y z\n", "course.prof:2:1: unknown profile z"},
+		{"profile x x\n", "course.prof:1:1: unknown profile x"},
+		{"profile x\n  add ifkw\n", "course.prof:2:3: unknown permit ifkw"},
+		{"profile x\nuse\n", "course.prof:2:1: missing name after use"},
+		{"profile x\nuse profile gro\n", "course.prof:2:1: a profile can't use another, but can build on it"},
+		{"profile x\ndynamic on\n", "course.prof:2:1: dynamic takes no arguments"},
+		{"profile x\nlevel 3\n", "course.prof:2:1: unknown keyword level"},
+	} {
+		_, err := ParseProfiles("/proj/course.prof", []byte(tst.src), known)
+		if err == nil || !strings.HasSuffix(err.Error(), tst.err) {
+			t.Errorf("ParseProfiles(%q): expected error %q but received %v", tst.src, tst.err, err)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestUserProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gro-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		ConfigName:           "profiles levels/course.prof\nprofile basics\n",
+		"levels/course.prof": "profile basics g0450\nremove elseKw\nuse blacklist ifKw\n",
+	}
+	for name, text := range files {
+		pth := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(pth, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tst := range []struct {
+		name, src, err string
+	}{
+		{"a.basics", "package main\nfunc main() {\n\tif x {\n\t}\n}\n", "a.basics:3:2: syntax error: if-statement has been disabled but is present"},
+		{"b.gro", "package main\nfunc main() {\n\tfor {\n\t}\n\tif x {\n\t}\n}\n", "b.gro:5:2: syntax error: if-statement has been disabled but is present"},
+		{"c.go", "use \"profile\"(\"basics\")\npackage main\n", "c.go:1:1: syntax error: \"use\" keywords are disabled but keyword is present"},
+		{"d.grog", "use \"profile\"(\"basics\")\npackage main\nfunc main() {\n\tif x {\n\t}\n}\n", "d.grog:4:2: syntax error: if-statement has been disabled but is present"},
+		{"e.grog", "use \"profile\"(\"advanced\")\npackage main\n", "e.grog:1:26: syntax error: use \"profile\" has unknown profile \"advanced\""},
+	} {
+		filename := filepath.Join(dir, tst.name)
+		_, err := ParseBytes(filename, src.NewFileBase(filename, filename), []byte(tst.src), nil, nil, 0, nil)
+		if err == nil || err.Error() != dir+string(filepath.Separator)+tst.err {
+			t.Errorf("%s: expected error %q but received %v", tst.name, tst.err, err)
+		}
+	}
+}
+
+//================================================================================
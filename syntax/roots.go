@@ -0,0 +1,123 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//================================================================================
+// An OutputRoot ties a directory on disk to the import path of the Go files
+// generated into it. It is the directory holding the nearest go.mod, with the
+// module path declared there, or else the src directory of the GOPATH entry
+// holding the files, with an empty import path. Files outside both go into
+// the directory itself.
+type OutputRoot struct {
+	Dir  string // absolute, slash-separated
+	Path string // import path of Dir
+}
+
+//--------------------------------------------------------------------------------
+// FindOutputRoot returns the output root for Go files generated into dir,
+// walking up from dir to find a go.mod file.
+func FindOutputRoot(dir string) (OutputRoot, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return OutputRoot{}, err
+	}
+	for d := abs; ; {
+		mod := filepath.Join(d, "go.mod")
+		data, err := ioutil.ReadFile(mod)
+		switch {
+		case err == nil:
+			modPath := ModulePath(data)
+			if modPath == "" {
+				return OutputRoot{}, fmt.Errorf("no module path in %s", filepath.ToSlash(mod))
+			}
+			return OutputRoot{Dir: filepath.ToSlash(d), Path: modPath}, nil
+		case !os.IsNotExist(err):
+			return OutputRoot{}, err
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		gopath = build.Default.GOPATH
+	}
+	for _, p := range filepath.SplitList(gopath) {
+		src := filepath.ToSlash(filepath.Join(p, "src"))
+		if root := filepath.ToSlash(abs); root == src || strings.HasPrefix(root, src+"/") {
+			return OutputRoot{Dir: src}, nil
+		}
+	}
+	return OutputRoot{Dir: filepath.ToSlash(abs)}, nil // neither in a module nor GOPATH
+}
+
+//--------------------------------------------------------------------------------
+// ModulePath returns the module path declared in the contents of a go.mod
+// file, or "" if there isn't one.
+func ModulePath(mod []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(mod))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if p, err := strconv.Unquote(fields[1]); err == nil {
+			return p
+		}
+		return fields[1]
+	}
+	return ""
+}
+
+//--------------------------------------------------------------------------------
+// ImportPath returns the import path of the Go files generated into dir,
+// which should be an absolute path within the root. A directory outside the
+// root is used as if it were relative to it.
+func (r OutputRoot) ImportPath(dir string) string {
+	dir = filepath.ToSlash(dir)
+	switch {
+	case dir == r.Dir:
+		return r.Path
+	case strings.HasPrefix(dir, r.Dir+"/"):
+		return path.Join(r.Path, dir[len(r.Dir)+1:])
+	}
+	return path.Join(r.Path, strings.TrimPrefix(dir, "/"))
+}
+
+//--------------------------------------------------------------------------------
+// FilePath returns where on disk to write a generated file, given its name
+// as returned by Parse, which begins with the import path of its directory.
+func (r OutputRoot) FilePath(name string) (string, error) {
+	name = filepath.ToSlash(name)
+	switch {
+	case r.Path == "":
+		return filepath.FromSlash(path.Join(r.Dir, name)), nil
+	case strings.HasPrefix(name, r.Path+"/"):
+		return filepath.FromSlash(path.Join(r.Dir, name[len(r.Path)+1:])), nil
+	}
+	return "", fmt.Errorf("generated file %s is outside module %s", name, r.Path)
+}
+
+//================================================================================
@@ -0,0 +1,69 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syntax
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//================================================================================
+func TestModulePath(t *testing.T) {
+	for _, tst := range []struct {
+		mod  string
+		want string
+	}{
+		{"module example.com/abc\n", "example.com/abc"},
+		{"// a comment\nmodule \"example.com/abc\" // another\n\ngo 1.12\n", "example.com/abc"},
+		{"go 1.12\n", ""},
+	} {
+		if got := ModulePath([]byte(tst.mod)); got != tst.want {
+			t.Errorf("ModulePath(%q): expected %q but received %q", tst.mod, tst.want, got)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+func TestFindOutputRoot(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tmp, _ = filepath.EvalSymlinks(tmp)
+	dir := filepath.Join(tmp, "cmd", "abc")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	//outside any module
+	root, err := FindOutputRoot(dir)
+	if err != nil || root.Dir != filepath.ToSlash(dir) || root.Path != "" {
+		t.Errorf("outside module: received %+v, %v", root, err)
+	}
+
+	//within a module
+	if err := ioutil.WriteFile(filepath.Join(tmp, "go.mod"), []byte("module example.com/xyz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err = FindOutputRoot(dir)
+	if err != nil || root.Dir != filepath.ToSlash(tmp) || root.Path != "example.com/xyz" {
+		t.Errorf("within module: received %+v, %v", root, err)
+	}
+	if got := root.ImportPath(dir); got != "example.com/xyz/cmd/abc" {
+		t.Errorf("ImportPath: received %q", got)
+	}
+	got, err := root.FilePath("example.com/xyz/cmd/abc/abc.go")
+	if want := filepath.Join(dir, "abc.go"); err != nil || got != want {
+		t.Errorf("FilePath: expected %q but received %q, %v", want, got, err)
+	}
+	if _, err := root.FilePath("example.com/other/abc.go"); err == nil {
+		t.Errorf("FilePath: expected error for file outside module")
+	}
+}
+
+//================================================================================
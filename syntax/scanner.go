@@ -53,8 +53,10 @@ func isDigit(c rune) bool {
 //--------------------------------------------------------------------------------
 type scanner struct {
 	source
-	pragh  func(line, col uint, msg string)
-	nlsemi bool // if set '\n' and EOF translate to ';'
+	pragh   func(line, col uint, msg string)
+	commh   func(line, col uint, text string)   // if set, called for each comment
+	permith func(line, col uint, permit string) // if set, called for each use of a feature needing a permit
+	nlsemi  bool                                // if set '\n' and EOF translate to ';'
 
 	// current token, valid after calling next()
 	line, col uint
@@ -262,8 +264,11 @@ redo:
 			r := s.getr()
 			s.startLit()
 			s.skipLine(r)
+			text := string(s.stopLit())
 			s.getr()
-			s.stopLit()
+			if s.commh != nil {
+				s.commh(s.line, s.col, "#!"+text)
+			}
 			goto redo
 		} else {
 			s.ident()
@@ -410,6 +415,12 @@ func (s *scanner) ident() {
 	s.ungetr()
 
 	lit := s.stopLit()
+	for _, b := range lit {
+		if b >= utf8.RuneSelf {
+			s.permit(s.line, s.col, "unicodeInIdNames")
+			break
+		}
+	}
 
 	// possibly a keyword
 	if len(lit) >= 2 {
@@ -445,6 +456,7 @@ func (s *scanner) isIdentRune(c rune, first bool) bool {
 //--------------------------------------------------------------------------------
 func (s *scanner) number(c rune) {
 	s.startLit()
+	elided := c == '.' // the zero before the point, as in .1
 
 	if c != '.' {
 		s.kind = nodes.IntLit // until proven otherwise
@@ -452,6 +464,7 @@ func (s *scanner) number(c rune) {
 			c = s.getr()
 			if c == 'x' || c == 'X' {
 				// hex
+				s.permit(s.line, s.col, "hexNums")
 				c = s.getr()
 				hasDigit := false
 				for isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' || c == '_' {
@@ -465,11 +478,12 @@ func (s *scanner) number(c rune) {
 			}
 
 			// decimal 0, octal, or float
-			has8or9 := false
+			has8or9, hasDigit := false, false
 			for isDigit(c) || c == '_' {
 				if c == '8' || c == '9' {
 					has8or9 = true
 				}
+				hasDigit = hasDigit || isDigit(c)
 				c = s.getr()
 			}
 			if c != '.' && c != 'e' && c != 'E' && c != 'i' {
@@ -477,8 +491,14 @@ func (s *scanner) number(c rune) {
 				if has8or9 {
 					s.error("malformed octal constant")
 				}
+				if hasDigit {
+					s.permit(s.line, s.col, "octalNums")
+				}
 				goto done
 			}
+			if hasDigit {
+				s.permit(s.line, s.col, "leadingZeroInFloats")
+			}
 
 		} else {
 			// decimal or float
@@ -492,9 +512,15 @@ func (s *scanner) number(c rune) {
 	if c == '.' {
 		s.kind = nodes.FloatLit
 		c = s.getr()
+		if !isDigit(c) {
+			elided = true // the zero after it, as in 0.
+		}
 		for isDigit(c) || c == '_' {
 			c = s.getr()
 		}
+		if elided {
+			s.permit(s.line, s.col, "elidedZeroInFloats")
+		}
 	}
 
 	// date
@@ -524,6 +550,7 @@ func (s *scanner) number(c rune) {
 	// complex
 	if c == 'i' {
 		s.kind = nodes.ImagLit
+		s.permit(s.line, s.col, "complexLits")
 		s.getr()
 	}
 
@@ -616,6 +643,7 @@ func (s *scanner) stdString() {
 //--------------------------------------------------------------------------------
 func (s *scanner) rawString() {
 	s.startLit()
+	s.permit(s.line, s.col, "rawStringSyntax")
 
 	for {
 		r := s.getr()
@@ -655,18 +683,29 @@ func (s *scanner) escape(quote rune) bool {
 	const maxUtf88Point = 0x7fbfffff //TODO: should reference utf88 package
 
 	c := s.getr()
+	line, col := s.line0, s.col0-1 // of the backslash
 	switch c {
-	case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', quote:
+	case '\\', quote:
+		return true
+	case 'a', 'b', 'f', 'n', 'r', 't', 'v':
+		s.permit(line, col, "escapesInStrings")
+		return true
+	case 'e':
+		s.permit(line, col, "escapeEscapeInStrings")
 		return true
 	case '0', '1', '2', '3', '4', '5', '6', '7':
+		s.permit(line, col, "octalInStrings")
 		n, base, max = 3, 8, 255
 	case 'x':
+		s.permit(line, col, "hexInStrings")
 		c = s.getr()
 		n, base, max = 2, 16, 255
 	case 'u':
+		s.permit(line, col, "shortUnicodeInStrings")
 		c = s.getr()
 		n, base, max = 4, 16, unicode.MaxRune
 	case 'U':
+		s.permit(line, col, "longUnicodeInStrings")
 		c = s.getr()
 		n, base = 8, 16
 		if s.dynamicMode {
@@ -731,7 +770,7 @@ func (s *scanner) lineComment() {
 	if s.col != colbase || s.pragh == nil || (r != 'g' && r != 'l') {
 		s.startLit()
 		s.skipLine(r)
-		s.comments = append(s.comments, "//"+string(s.stopLit()))
+		s.comment("//" + string(s.stopLit()))
 		return
 	}
 	// s.col == colbase && s.pragh != nil && (r == 'g' || r == 'l')
@@ -747,7 +786,7 @@ func (s *scanner) lineComment() {
 			s.startLit()
 			s.skipLine(r)
 			text := s.stopLit()
-			s.comments = append(s.comments, "//"+rs+string(text))
+			s.comment("//" + rs + string(text))
 			return
 		}
 		rs += string(r)
@@ -763,19 +802,38 @@ func (s *scanner) lineComment() {
 	}
 
 	s.pragh(s.line, s.col+2, prefix+string(text)) // +2 since directive text starts after //
-	s.comments = append(s.comments, "//"+prefix+string(text))
+	s.comment("//" + prefix + string(text))
+}
+
+//--------------------------------------------------------------------------------
+// permit calls the permit handler, if set, for the use of a feature at
+// (line, col) which the permit enables.
+func (s *scanner) permit(line, col uint, permit string) {
+	if s.permith != nil {
+		s.permith(line, col, permit)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// comment records the text of a comment starting at the current token position.
+func (s *scanner) comment(text string) {
+	s.comments = append(s.comments, text)
+	if s.commh != nil {
+		s.commh(s.line, s.col, text)
+	}
 }
 
 //--------------------------------------------------------------------------------
 func (s *scanner) fullComment() {
 	s.startLit()
+	s.permit(s.line, s.col, "blockComments")
 
 	for {
 		r := s.getr()
 		for r == '*' {
 			r = s.getr()
 			if r == '/' {
-				s.comments = append(s.comments, "/"+string(s.stopLit()))
+				s.comment("/" + string(s.stopLit()))
 				return
 			}
 		}
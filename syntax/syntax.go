@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/grolang/gro/nodes"
 	"github.com/grolang/gro/syntax/src"
@@ -24,12 +26,25 @@ const (
 
 // Error describes a syntax error. Error implements the error interface.
 type Error struct {
-	Pos src.Pos
-	Msg string
+	Pos  src.Pos
+	End  src.Pos // end of the token in error, or Pos if not known
+	Code string  // permit disabled, or "" if not a permit error
+	Msg  string
+
+	// Trail holds the positions of the include declarations the file with the
+	// error was included by, innermost first, if it's an included file.
+	Trail []src.Pos
 }
 
 func (err Error) Error() string {
-	return fmt.Sprintf("%s: %s", err.Pos, err.Msg)
+	if len(err.Trail) == 0 {
+		return fmt.Sprintf("%s: %s", err.Pos, err.Msg)
+	}
+	trail := make([]string, len(err.Trail))
+	for i, pos := range err.Trail {
+		trail[i] = pos.String()
+	}
+	return fmt.Sprintf("%s: %s (included from %s)", err.Pos, err.Msg, strings.Join(trail, ", "))
 }
 
 var _ error = Error{} // verify that Error implements error
@@ -63,28 +78,54 @@ type PragmaHandler func(pos src.Pos, text string) Pragma
 // The Mode argument is currently ignored.
 func Parse(filename string, base *src.PosBase, src io.Reader, errh ErrorHandler, pragh PragmaHandler, mode Mode,
 	f func(string) (string, error)) (
-	_ map[string]*nodes.File, first error) {
+	map[string]*nodes.File, error) {
+	return parse("", filename, base, src, errh, pragh, mode, f)
+}
+
+//--------------------------------------------------------------------------------
+func parse(outDir, filename string, base *src.PosBase, src io.Reader, errh ErrorHandler, pragh PragmaHandler, mode Mode,
+	f func(string) (string, error)) (
+	map[string]*nodes.File, error) {
+	_, files, err := parseProj(nil, outDir, filename, base, src, errh, pragh, mode, f)
+	return files, err
+}
+
+//--------------------------------------------------------------------------------
+// parseProj returns the project parsed as well as the Go files it generates,
+// recording the files included in incl if it's not nil.
+func parseProj(incl *includes, outDir, filename string, base *src.PosBase, src io.Reader, errh ErrorHandler, pragh PragmaHandler, mode Mode,
+	f func(string) (string, error)) (
+	_ *nodes.Project, _ map[string]*nodes.File, first error) {
+	var p parser
 	defer func() {
-		if p := recover(); p != nil {
-			if err, ok := p.(Error); ok {
+		if pnc := recover(); pnc != nil {
+			if err, ok := pnc.(Error); ok {
 				first = err
 				return
 			}
-			panic(p)
+			if _, ok := pnc.(runtime.Error); !ok && errh != nil && p.first != nil {
+				first = p.first // the parser bailing out of source already reported as broken
+				return
+			}
+			panic(pnc)
 		}
 	}()
 
-	var p parser
 	p.init(base, src, errh, pragh, mode, f)
+	p.outDir = outDir
+	p.incl = incl
 	p.Next()
 	proj := p.Proj(filename)
+	if p.first != nil { // only when errh is collecting the errors
+		return proj, nil, p.first
+	}
 	files := p.ProjToFiles(proj)
-	return files, p.first
+	return proj, files, p.first
 }
 
 //--------------------------------------------------------------------------------
 // NOTE: called from syntax test: asts, err :=        ParseBytes(tst.fnm,  nil, []byte(tst.src), nil, nil, 0, getFile)
-// NOTE: called from sys.go:      asts, err := syntax.ParseBytes(filename, nil, src,             nil, nil, 0, GetFile)
+// NOTE: called from sys.go:      asts, inputs, err := syntax.ParseBytesCached(cache, s.OutDir, filename, base, src, nil, nil, 0, getFile)
 
 // ParseBytes behaves like Parse but it reads the source from the []byte slice provided.
 func ParseBytes(filename string, base *src.PosBase, src []byte, errh ErrorHandler, pragh PragmaHandler, mode Mode, f func(string) (string, error)) (
@@ -92,6 +133,44 @@ func ParseBytes(filename string, base *src.PosBase, src []byte, errh ErrorHandle
 	return Parse(filename, base, &bytesReader{src}, errh, pragh, mode, f)
 }
 
+// ParseBytesTo behaves like ParseBytes but it generates the Go files for the
+// directory outDir, rather than for the directory of the file.
+func ParseBytesTo(outDir, filename string, base *src.PosBase, src []byte, errh ErrorHandler, pragh PragmaHandler, mode Mode,
+	f func(string) (string, error)) (map[string]*nodes.File, error) {
+	return parse(outDir, filename, base, &bytesReader{src}, errh, pragh, mode, f)
+}
+
+// Inputs are the files a Gro file is parsed from, other than itself.
+type Inputs struct {
+	Files    map[string]string // the text of each file included, by absolute path
+	Patterns []IncludePattern  // the include patterns expanded, in the order found
+	Profile  string            // name of the profile parsed with, unless parsing stopped at an error
+}
+
+// ParseBytesCached behaves like ParseBytesTo, but it shares the files included
+// with the other Gro files parsed with the same cache, so each is read and
+// parsed only once, and it returns the files included.
+func ParseBytesCached(cache *IncludeCache, outDir, filename string, base *src.PosBase, src []byte, errh ErrorHandler,
+	pragh PragmaHandler, mode Mode, f func(string) (string, error)) (map[string]*nodes.File, Inputs, error) {
+	incl := &includes{cache: cache}
+	proj, files, err := parseProj(incl, outDir, filename, base, &bytesReader{src}, errh, pragh, mode, f)
+	inputs := Inputs{Files: incl.texts, Patterns: incl.patterns}
+	if proj != nil {
+		inputs.Profile = proj.Profile
+	}
+	return files, inputs, err
+}
+
+// ParseProject behaves like ParseBytes but it returns the project parsed, with
+// its packages and their sections, rather than the Go files generated. With an
+// ErrorHandler, the project is returned along with the first error, as far as
+// it could be parsed, so its header and permits can still be looked at.
+func ParseProject(filename string, base *src.PosBase, src []byte, errh ErrorHandler, f func(string) (string, error)) (
+	*nodes.Project, error) {
+	proj, _, err := parseProj(nil, "", filename, base, &bytesReader{src}, errh, nil, 0, f)
+	return proj, err
+}
+
 type bytesReader struct {
 	data []byte
 }
@@ -0,0 +1,298 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the version of Gro, which the programs Execute caches are built by.
+const Version = "0.8.1"
+
+// CacheEnv is the environment variable giving the directory Execute caches the
+// programs it builds in, instead of the gro directory in the user's cache
+// directory. If it's "off", no programs are cached.
+const CacheEnv = "GROCACHE"
+
+const (
+	cacheInfo = "info.json"
+	cacheProg = "prog"
+)
+
+//================================================================================
+// A cacheEntry records the Gro file a cached program was built from, and the
+// extra files it parsed, as the cache key can only hold the Gro file itself.
+type cacheEntry struct {
+	File     string            `json:"file"`               // absolute path
+	Includes map[string]string `json:"includes,omitempty"` // hashes of the extra files parsed, by absolute path
+	Patterns []includePattern  `json:"patterns,omitempty"` // the include patterns expanded, with absolute dirs
+}
+
+//--------------------------------------------------------------------------------
+// CacheDir returns the directory Execute caches programs in, or "" if caching
+// is turned off.
+func CacheDir() (string, error) {
+	dir := os.Getenv(CacheEnv)
+	switch {
+	case dir == "off":
+		return "", nil
+	case dir != "":
+		return filepath.Abs(dir)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("%s (set %s to choose a cache directory)", err, CacheEnv)
+	}
+	return filepath.Join(dir, "gro"), nil
+}
+
+//--------------------------------------------------------------------------------
+// cacheDir returns the directory of the cache entry for a Gro file, or "" if
+// caching is turned off. Its name is the hash of the Gro file, with its path
+// and output directory or workspace, which the Go files generated depend on,
+// and the versions of Gro and Go it's built by. The profile it's parsed with
+// follows from those and the configuration files, which the entry records
+// among the extra files parsed.
+func (s *Session) cacheDir(filename string) (string, error) {
+	cache, err := CacheDir()
+	if cache == "" || err != nil {
+		return "", err
+	}
+	text, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", nil // left to Prepare to report
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	outDir := workspaceModule // the same for every workspace
+	if !s.Hermetic && !s.Keep {
+		if outDir, err = filepath.Abs(s.outputDir(filename)); err != nil {
+			return "", err
+		}
+	}
+	key := fmt.Sprintf("gro %s\ngo %s %s/%s\nfile %s\noutput %s\nsource %s\n",
+		Version, runtime.Version(), runtime.GOOS, runtime.GOARCH,
+		abs, outDir, hashOf(text))
+	return filepath.Join(cache, hashOf([]byte(key))), nil
+}
+
+//--------------------------------------------------------------------------------
+// cachedProg returns the program in a cache entry, if there is one and the
+// extra files it was built with are unchanged, as are the files its include
+// patterns match. Its info file is touched, to record when the entry was last
+// used.
+func cachedProg(dir string) (string, bool) {
+	entry, err := readCacheEntry(dir)
+	if err != nil {
+		return "", false
+	}
+	for name, hash := range entry.Includes {
+		text, err := ioutil.ReadFile(name)
+		if err != nil || hashOf(text) != hash {
+			return "", false
+		}
+	}
+	for _, pt := range entry.Patterns {
+		if !pt.unchanged(pt.Dir) {
+			return "", false
+		}
+	}
+	prog := progPath(dir, cacheProg)
+	if _, err := os.Stat(prog); err != nil {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(filepath.Join(dir, cacheInfo), now, now)
+	return prog, true
+}
+
+func readCacheEntry(dir string) (*cacheEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, cacheInfo))
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+//--------------------------------------------------------------------------------
+// cacheProgram builds the Go file prepared from a Gro file into a cache entry,
+// recording the extra files parsed and the include patterns expanded as the
+// manifest gives them, and returns the program. The program is built under a temporary name then renamed, so that
+// another gro running it at the same time never sees it half written.
+func (s *Session) cacheProgram(dir, filename, outfile string) (string, bool) {
+	m, err := readManifest(s.outputDir(filename))
+	if err != nil {
+		s.fail(err)
+		return "", false
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		s.fail(err)
+		return "", false
+	}
+	entry := &cacheEntry{File: abs, Includes: map[string]string{}}
+	if src, ok := m.Sources[m.rel(filename)]; ok {
+		for name, hash := range src.Includes {
+			if pth, err := filepath.Abs(m.path(name)); err == nil {
+				entry.Includes[pth] = hash
+			}
+		}
+		for _, pt := range src.Patterns {
+			if pth, err := filepath.Abs(m.path(pt.Dir)); err == nil {
+				pt.Dir = pth
+				entry.Patterns = append(entry.Patterns, pt)
+			}
+		}
+	}
+	data, err := json.MarshalIndent(entry, "", "\t")
+	if err != nil {
+		s.fail(err)
+		return "", false
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.fail(err)
+		return "", false
+	}
+
+	tmp, err := ioutil.TempDir(dir, "build")
+	if err != nil {
+		s.fail(err)
+		return "", false
+	}
+	defer os.RemoveAll(tmp)
+	built := progPath(tmp, cacheProg)
+	if !s.buildGoFile(outfile, built) {
+		return "", false
+	}
+	prog := progPath(dir, cacheProg)
+	if err := os.Rename(built, prog); err != nil {
+		s.fail(err)
+		return "", false
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, cacheInfo), append(data, '\n'), 0644); err != nil {
+		s.fail(err)
+		return "", false
+	}
+	return prog, true
+}
+
+// progPath returns the path of a program built into a directory.
+func progPath(dir, name string) string {
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, name)
+}
+
+//================================================================================
+// Cache manages the programs Execute caches. With the arg "list", it prints the
+// Gro file each was built from, when it was last used, and its size, most
+// recently used first. With "clean", it removes them all, along with any left
+// half built. With "dir", it prints the cache directory.
+func (s *Session) Cache(args ...string) {
+	if len(args) != 1 || (args[0] != "list" && args[0] != "clean" && args[0] != "dir") {
+		fmt.Fprintf(s.Stderr, "%s: usage: gro cache list|clean|dir\n", s.ProgName)
+		s.setExitStatus(2)
+		return
+	}
+	cache, err := CacheDir()
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	if cache == "" {
+		fmt.Fprintf(s.Stderr, "%s: caching is turned off by %s=off\n", s.ProgName, CacheEnv)
+		return
+	}
+	if args[0] == "dir" {
+		fmt.Fprintln(s.Stdout, cache)
+		return
+	}
+	dirs, err := ioutil.ReadDir(cache)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		s.fail(err)
+		return
+	}
+
+	if args[0] == "clean" {
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			pth := filepath.Join(cache, dir.Name())
+			if s.WantMsgs {
+				name := dir.Name()
+				if entry, err := readCacheEntry(pth); err == nil {
+					name = shortPath(entry.File)
+				}
+				fmt.Fprintf(s.Stderr, "%s: removing cached build of %s\n", s.ProgName, name)
+			}
+			if err := os.RemoveAll(pth); err != nil {
+				s.fail(err)
+			}
+		}
+		return
+	}
+
+	type listed struct {
+		file string
+		used time.Time
+		size int64
+	}
+	var list []listed
+	for _, dir := range dirs {
+		entry, err := readCacheEntry(filepath.Join(cache, dir.Name()))
+		if err != nil {
+			continue // not a cache entry, or one being built
+		}
+		info, err1 := os.Stat(filepath.Join(cache, dir.Name(), cacheInfo))
+		prog, err2 := os.Stat(progPath(filepath.Join(cache, dir.Name()), cacheProg))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		list = append(list, listed{shortPath(entry.File), info.ModTime(), prog.Size()})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].used.Equal(list[j].used) {
+			return list[i].used.After(list[j].used)
+		}
+		return list[i].file < list[j].file
+	})
+	for _, l := range list {
+		fmt.Fprintf(s.Stdout, "%s %7s %s\n", l.used.Format("2006-01-02 15:04"), byteSize(l.size), l.file)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// byteSize returns a size in bytes as a short string, such as 1.8M.
+func byteSize(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	size, unit := float64(n)/1024, 0
+	for size >= 1024 && unit < len(units)-1 {
+		size, unit = size/1024, unit+1
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", size), ".0") + units[unit:unit+1]
+}
+
+//================================================================================
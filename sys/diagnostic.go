@@ -0,0 +1,66 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/grolang/gro/syntax"
+)
+
+//================================================================================
+// A Diagnostic is an error as printed with the JSON option, one per line.
+// Errors not from parsing a Gro file have only a severity and message.
+type Diagnostic struct {
+	File      string `json:"file,omitempty"`
+	Line      uint   `json:"line,omitempty"`
+	Column    uint   `json:"column,omitempty"`
+	EndLine   uint   `json:"endLine,omitempty"`
+	EndColumn uint   `json:"endColumn,omitempty"`
+	Severity  string `json:"severity"`
+	Code      string `json:"code,omitempty"` // permit disabled, such as "useKw"
+	Message   string `json:"message"`
+
+	// IncludedFrom holds the include declarations the file with the error was
+	// included by, innermost first, each as file:line:column.
+	IncludedFrom []string `json:"includedFrom,omitempty"`
+}
+
+//--------------------------------------------------------------------------------
+// NewDiagnostic returns the Diagnostic for an error.
+func NewDiagnostic(err error) Diagnostic {
+	d := Diagnostic{Severity: "error", Message: err.Error()}
+	if se, ok := err.(syntax.Error); ok {
+		d.File = se.Pos.Filename()
+		d.Line, d.Column = se.Pos.Line(), se.Pos.Col()
+		if se.End.IsKnown() {
+			d.EndLine, d.EndColumn = se.End.Line(), se.End.Col()
+		}
+		d.Code = se.Code
+		d.Message = se.Msg
+		for _, pos := range se.Trail {
+			d.IncludedFrom = append(d.IncludedFrom, pos.String())
+		}
+	}
+	return d
+}
+
+//--------------------------------------------------------------------------------
+// report prints an error, as a Diagnostic if the JSON option is set, or else
+// as text, preceded by the program name if prog is true.
+func (s *Session) report(err error, prog bool) {
+	switch {
+	case s.JSON:
+		data, _ := json.Marshal(NewDiagnostic(err)) // can't fail
+		fmt.Fprintf(s.Stderr, "%s\n", data)
+	case prog:
+		fmt.Fprintf(s.Stderr, "%s: %s\n", s.ProgName, err)
+	default:
+		fmt.Fprintf(s.Stderr, "%s\n", err)
+	}
+}
+
+//================================================================================
@@ -0,0 +1,181 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+//================================================================================
+// An edit is one line of a diff: kept (' '), deleted ('-') or inserted ('+').
+type edit struct {
+	op   byte
+	line string
+}
+
+const diffContext = 3 // unchanged lines shown around each change
+
+//--------------------------------------------------------------------------------
+// diff returns a unified diff turning old into gen, with both labelled by the
+// given filename, or nil if they're the same.
+func diff(filename string, old, gen []byte) []byte {
+	if bytes.Equal(old, gen) {
+		return nil
+	}
+	edits := diffLines(splitLines(old), splitLines(gen))
+
+	// lines of old and gen before each edit
+	oldAt := make([]int, len(edits)+1)
+	newAt := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if e.op != '+' {
+			oldAt[i+1]++
+		}
+		if e.op != '-' {
+			newAt[i+1]++
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\t(on disk)\n+++ %s\t(generated)\n", filename, filename)
+	for i, done := 0, 0; ; {
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+		start := i - diffContext
+		if start < done {
+			start = done
+		}
+
+		// extend the hunk over changes separated by few enough unchanged lines
+		end := i
+		for {
+			for end < len(edits) && edits[end].op != ' ' {
+				end++
+			}
+			same := end
+			for same < len(edits) && edits[same].op == ' ' {
+				same++
+			}
+			if same < len(edits) && same-end <= 2*diffContext {
+				end = same
+				continue
+			}
+			if end += diffContext; end > same {
+				end = same
+			}
+			break
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldAt[start], oldAt[end]), hunkRange(newAt[start], newAt[end]))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i, done = end, end
+	}
+	return out.Bytes()
+}
+
+//--------------------------------------------------------------------------------
+// hunkRange formats the lines from..to of a hunk header, counting from one.
+func hunkRange(from, to int) string {
+	switch to - from {
+	case 0:
+		return fmt.Sprintf("%d,0", from)
+	case 1:
+		return fmt.Sprintf("%d", from+1)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+//--------------------------------------------------------------------------------
+func splitLines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+//--------------------------------------------------------------------------------
+// diffLines finds the shortest edit script turning a into b, using Myers'
+// algorithm: v[k] holds the furthest x reached along diagonal k = x-y, and
+// the part of v in use, diagonals -d..d, is kept for each edit distance d so
+// the path can be traced back.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1] // down: insert from b
+			} else {
+				x = v[off+k-1] + 1 // right: delete from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d] // v[d+k] holds diagonal k
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && v[d+k-1] < v[d+k+1] {
+			prevK = k + 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			edits = append(edits, edit{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{'+', b[y]})
+		} else {
+			x--
+			edits = append(edits, edit{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		edits = append(edits, edit{' ', a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+//================================================================================
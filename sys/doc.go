@@ -0,0 +1,273 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/grolang/gro/nodes"
+	"github.com/grolang/gro/syntax"
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+// docProject is the documentation of a Gro project, as printed by Doc.
+type docProject struct {
+	Name string
+	Doc  string
+	Pkgs []docPackage
+}
+
+type docPackage struct {
+	Name   string
+	Params string // such as "(T, U)" for a generic package
+	Path   string // import path
+	Doc    string
+	Sects  []docSection
+}
+
+// A docSection holds the exported declarations of a section. The section a
+// package starts with, before any section keyword, has no keyword or name.
+type docSection struct {
+	Kw    string // "section" or "main"
+	Name  string
+	Decls []docDecl
+}
+
+type docDecl struct {
+	Code string // the Go declaration, without any function body
+	Doc  string
+}
+
+//--------------------------------------------------------------------------------
+// Doc prints the documentation of each Gro file given: the project doc comment,
+// then each package with its generic parameters, import path and doc comment,
+// then the exported declarations in each section of the package, with their
+// doc comments. Testcode sections are left out. It prints text, or if the HTML
+// option is set, an HTML page.
+func (s *Session) Doc(args ...string) {
+	if len(args) < 1 {
+		fmt.Fprintf(s.Stderr, "%s: usage: gro doc [-html] path ...\nNot enough arguments given.\n", s.ProgName)
+		s.setExitStatus(2)
+		return
+	}
+	projs := []docProject{}
+	for _, filename := range args {
+		if s.WantMsgs {
+			fmt.Fprintf(s.Stderr, "%s: documenting %s\n", s.ProgName, filename)
+		}
+		text, err := ioutil.ReadFile(filename)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		proj, err := syntax.ParseProject(filename, src.NewFileBase(filename, filename), text, nil, s.GetFile)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		projs = append(projs, newDocProject(proj))
+	}
+	var err error
+	if s.HTML {
+		err = docHTML.Execute(s.Stdout, projs)
+	} else {
+		err = docText.Execute(s.Stdout, projs)
+	}
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+//--------------------------------------------------------------------------------
+func newDocProject(proj *nodes.Project) docProject {
+	dp := docProject{Name: proj.Name, Doc: docString(strings.Join(proj.Doc, "\n"))}
+	for _, pkg := range proj.Pkgs {
+		dk := docPackage{Name: pkg.Name, Path: path.Join(proj.Root, pkg.Dir)}
+		if len(pkg.Params) > 0 {
+			params := []string{}
+			for _, param := range pkg.Params {
+				params = append(params, param.Value)
+			}
+			dk.Params = "(" + strings.Join(params, ", ") + ")"
+		}
+		for _, f := range pkg.Files {
+			if dk.Name == "" {
+				dk.Name = f.PkgName.Value // inferred
+			}
+			if c := f.Comments(); c != nil && c.Above != nil && dk.Doc == "" {
+				dk.Doc = docString(c.Above.Text)
+			}
+			if f.HeadKw == "testcode" {
+				continue
+			}
+			ds := docSection{Kw: f.HeadKw, Name: f.SectName}
+			for _, decl := range f.DeclList {
+				if dd, ok := newDocDecl(decl); ok {
+					ds.Decls = append(ds.Decls, dd)
+				}
+			}
+			if ds.Name == "" || len(ds.Decls) > 0 {
+				dk.Sects = append(dk.Sects, ds)
+			}
+		}
+		dp.Pkgs = append(dp.Pkgs, dk)
+	}
+	return dp
+}
+
+//--------------------------------------------------------------------------------
+// newDocDecl returns the documentation of a declaration, and whether it's
+// exported. A declaration in a group has the doc comment of the group.
+func newDocDecl(decl nodes.Decl) (docDecl, bool) {
+	var exported bool
+	var group *nodes.DeclGroup
+	kw := ""
+	switch d := decl.(type) {
+	case *nodes.FuncDecl:
+		exported = isExported(d.Name.Value) && (d.Recv == nil || isExported(recvTypeName(d.Recv.Type)))
+		sig := *d
+		sig.Body = nil
+		decl = &sig
+	case *nodes.TypeDecl:
+		exported, group, kw = isExported(d.Name.Value), d.Group, "type "
+	case *nodes.VarDecl:
+		exported, group, kw = anyExported(d.NameList), d.Group, "var "
+	case *nodes.ConstDecl:
+		exported, group, kw = anyExported(d.NameList), d.Group, "const "
+	}
+	if !exported {
+		return docDecl{}, false
+	}
+
+	dd := docDecl{Code: strings.TrimSpace(syntax.StringWithLinebreaks(decl))}
+	if c := decl.Comments(); c != nil && c.Above != nil {
+		dd.Code = strings.TrimSpace(strings.TrimPrefix(dd.Code, c.Above.Text))
+		dd.Doc = docString(c.Above.Text)
+	}
+	if group != nil {
+		dd.Code = kw + dd.Code // printed without its keyword, which is on the group
+		if c := group.Comments(); c != nil && c.Above != nil && dd.Doc == "" {
+			dd.Doc = docString(c.Above.Text)
+		}
+	}
+	return dd, true
+}
+
+//--------------------------------------------------------------------------------
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+func anyExported(names []*nodes.Name) bool {
+	for _, name := range names {
+		if isExported(name.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// recvTypeName returns the name of the type of a method receiver, such as T
+// for *T.
+func recvTypeName(typ nodes.Expr) string {
+	switch t := typ.(type) {
+	case *nodes.Name:
+		return t.Value
+	case *nodes.Operation:
+		return recvTypeName(t.X)
+	case *nodes.ParenExpr:
+		return recvTypeName(t.X)
+	}
+	return ""
+}
+
+//--------------------------------------------------------------------------------
+// docString returns the text of a doc comment, without the comment markers.
+func docString(comment string) string {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "//"):
+			line = strings.TrimPrefix(line[2:], " ")
+		case strings.HasPrefix(line, "/*"):
+			line = strings.TrimSpace(strings.TrimSuffix(line[2:], "*/"))
+		case strings.HasSuffix(line, "*/"):
+			line = strings.TrimSpace(line[:len(line)-2])
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+//--------------------------------------------------------------------------------
+// indent indents each non-blank line of the text with the prefix.
+func indent(prefix, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// paragraphs splits doc text at its blank lines.
+func paragraphs(text string) []string {
+	var paras []string
+	for _, para := range strings.Split(text, "\n\n") {
+		if para = strings.TrimSpace(para); para != "" {
+			paras = append(paras, para)
+		}
+	}
+	return paras
+}
+
+//================================================================================
+var docText = template.Must(template.New("doc").Funcs(template.FuncMap{"indent": indent}).Parse(
+	`{{range $i, $proj := .}}{{if $i}}
+{{end}}PROJECT {{.Name}}
+{{with .Doc}}
+{{indent "    " .}}
+{{end}}{{range .Pkgs}}
+PACKAGE {{.Name}}{{.Params}}
+    import "{{.Path}}"
+{{with .Doc}}
+{{indent "    " .}}
+{{end}}{{range .Sects}}{{if .Kw}}
+  {{.Kw}} "{{.Name}}"
+{{end}}{{range .Decls}}
+{{indent "    " .Code}}
+{{with .Doc}}{{indent "        " .}}
+{{end}}{{end}}{{end}}{{end}}{{end}}`))
+
+var docHTML = htmltemplate.Must(htmltemplate.New("doc").Funcs(htmltemplate.FuncMap{"paragraphs": paragraphs}).Parse(
+	`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{range $i, $proj := .}}{{if $i}}, {{end}}{{.Name}}{{end}} - Gro documentation</title>
+</head>
+<body>
+{{range .}}<h1>Project {{.Name}}</h1>
+{{range paragraphs .Doc}}<p>{{.}}</p>
+{{end}}{{range .Pkgs}}<h2 id="{{.Path}}">Package {{.Name}}{{.Params}}</h2>
+<p><code>import "{{.Path}}"</code></p>
+{{range paragraphs .Doc}}<p>{{.}}</p>
+{{end}}{{range .Sects}}{{if .Kw}}<h3>{{.Kw}} "{{.Name}}"</h3>
+{{end}}{{range .Decls}}<pre>{{.Code}}</pre>
+{{range paragraphs .Doc}}<p>{{.}}</p>
+{{end}}{{end}}{{end}}{{end}}{{end}}</body>
+</html>
+`))
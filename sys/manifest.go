@@ -0,0 +1,292 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/grolang/gro/syntax"
+)
+
+// ManifestName is the name of the manifest Prepare writes into each directory
+// the Go files are generated into, i.e. that of the Gro file or the OutDir.
+const ManifestName = ".gro-manifest.json"
+
+//================================================================================
+// A manifest records what each Gro file prepared into a directory was prepared
+// from, and the Go files generated, so unchanged Gro files needn't be prepared
+// again, and Clean can remove exactly the files generated. Paths in it are
+// slash-separated and relative to the directory.
+type manifest struct {
+	dir     string
+	changed bool
+
+	Sources map[string]*source `json:"sources"`
+}
+
+// A source is the manifest entry for a Gro file. All hashes are SHA-256.
+type source struct {
+	Hash     string            `json:"hash"`
+	Profile  string            `json:"profile"`            // name of the profile parsed with
+	Includes map[string]string `json:"includes,omitempty"` // hashes of the extra files parsed
+	Patterns []includePattern  `json:"patterns,omitempty"` // the include patterns expanded
+	Outputs  map[string]string `json:"outputs"`            // hashes of the Go files generated
+}
+
+// An includePattern is an include declaration naming files by a pattern, with
+// the files it matched, so the Gro file is prepared again when it would match
+// others.
+type includePattern struct {
+	Dir   string   `json:"dir"`   // of the file with the declaration
+	Name  string   `json:"name"`  // the pattern
+	Files []string `json:"files"` // relative to Dir
+}
+
+// unchanged reports whether the pattern still matches the same files, given
+// where its Dir is on disk.
+func (pt includePattern) unchanged(dir string) bool {
+	files, err := syntax.ExpandInclude(dir, pt.Name)
+	if err != nil || len(files) != len(pt.Files) {
+		return false
+	}
+	for i, name := range files {
+		if name != pt.Files[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//--------------------------------------------------------------------------------
+// readManifest reads the manifest in the directory, returning an empty one if
+// there isn't one there.
+func readManifest(dir string) (*manifest, error) {
+	m := &manifest{dir: dir}
+	data, err := ioutil.ReadFile(m.path(ManifestName))
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("%s: %s", shortPath(m.path(ManifestName)), err)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	if m.Sources == nil {
+		m.Sources = map[string]*source{}
+	}
+	return m, nil
+}
+
+//--------------------------------------------------------------------------------
+// write writes the manifest to its directory, or removes it if it's empty.
+func (m *manifest) write() error {
+	if len(m.Sources) == 0 {
+		if err := os.Remove(m.path(ManifestName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.path(ManifestName), append(data, '\n'), 0644)
+}
+
+//--------------------------------------------------------------------------------
+// rel returns the name of a file as recorded in the manifest.
+func (m *manifest) rel(name string) string {
+	dir, err := filepath.Abs(m.dir)
+	if err == nil {
+		if abs, err := filepath.Abs(name); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+	return filepath.ToSlash(name)
+}
+
+// path returns where a file recorded in the manifest is on disk.
+func (m *manifest) path(rel string) string {
+	return filepath.Join(m.dir, filepath.FromSlash(rel))
+}
+
+//--------------------------------------------------------------------------------
+// upToDate reports whether the Gro file and the extra files it parsed are the
+// same as when it was last prepared, its include patterns match the same files,
+// and the Go files generated are still as written.
+func (m *manifest) upToDate(filename string) bool {
+	src, ok := m.Sources[m.rel(filename)]
+	if !ok {
+		return false
+	}
+	for _, pt := range src.Patterns {
+		if !pt.unchanged(m.path(pt.Dir)) {
+			return false
+		}
+	}
+	hashes := map[string]string{m.rel(filename): src.Hash}
+	for name, hash := range src.Includes {
+		hashes[name] = hash
+	}
+	for name, hash := range src.Outputs {
+		hashes[name] = hash
+	}
+	for name, hash := range hashes {
+		text, err := ioutil.ReadFile(m.path(name))
+		if err != nil || hashOf(text) != hash {
+			return false
+		}
+	}
+	return true
+}
+
+//--------------------------------------------------------------------------------
+// outputs returns the Go files recorded as generated from a Gro file, with
+// absolute paths, in order of name.
+func (m *manifest) outputs(filename string) []generated {
+	var files []generated
+	if src, ok := m.Sources[m.rel(filename)]; ok {
+		for _, name := range sortedKeys(src.Outputs) {
+			if abs, err := filepath.Abs(m.path(name)); err == nil {
+				files = append(files, generated{name: abs})
+			}
+		}
+	}
+	return files
+}
+
+//--------------------------------------------------------------------------------
+// add records the Go files written for a Gro file.
+func (m *manifest) add(pr *prepared) {
+	src := &source{
+		Hash:     pr.hash,
+		Profile:  pr.profile,
+		Includes: map[string]string{},
+		Outputs:  map[string]string{},
+	}
+	for name, hash := range pr.includes {
+		src.Includes[m.rel(name)] = hash
+	}
+	for _, pt := range pr.patterns {
+		pt.Dir = m.rel(pt.Dir)
+		src.Patterns = append(src.Patterns, pt)
+	}
+	for _, g := range pr.files {
+		src.Outputs[m.rel(g.name)] = hashOf(g.text)
+	}
+	m.Sources[m.rel(pr.filename)] = src
+	m.changed = true
+}
+
+//--------------------------------------------------------------------------------
+func hashOf(text []byte) string {
+	sum := sha256.Sum256(text)
+	return hex.EncodeToString(sum[:])
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//================================================================================
+// Clean removes the Go files recorded in the manifests within the given
+// directories, recursively, then the manifests themselves. A Go file changed
+// since it was generated is reported and kept, along with its manifest entry.
+// With no paths, it cleans the current directory. If DryRun is set, it prints
+// the names of the files instead of removing them.
+func (s *Session) Clean(args ...string) {
+	if len(args) < 1 {
+		args = []string{"."}
+	}
+	var dirs []string
+	for _, pth := range args {
+		switch dir, err := os.Stat(pth); {
+		case err != nil:
+			s.fail(err)
+			return
+		case !dir.IsDir():
+			s.fail(fmt.Errorf("%s is not a directory", pth))
+			return
+		}
+		filepath.Walk(pth, func(pth string, f os.FileInfo, err error) error {
+			if err != nil {
+				s.fail(err)
+			} else if !f.IsDir() && f.Name() == ManifestName {
+				dirs = append(dirs, filepath.Dir(pth))
+			}
+			return nil
+		})
+	}
+	for _, dir := range dirs {
+		if err := s.cleanDir(dir); err != nil {
+			s.fail(err)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+func (s *Session) cleanDir(dir string) error {
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(m.Sources))
+	for name := range m.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		src := m.Sources[name]
+		for _, out := range sortedKeys(src.Outputs) {
+			pth := m.path(out)
+			text, err := ioutil.ReadFile(pth)
+			switch {
+			case os.IsNotExist(err):
+				delete(src.Outputs, out)
+				continue
+			case err != nil:
+				return err
+			case hashOf(text) != src.Outputs[out]:
+				fmt.Fprintf(s.Stderr, "%s: %s has changed since it was generated, so is kept\n", s.ProgName, shortPath(pth))
+				s.setExitStatus(1)
+				continue
+			}
+			if s.DryRun {
+				fmt.Fprintln(s.Stdout, shortPath(pth))
+				continue
+			}
+			if s.WantMsgs {
+				fmt.Fprintf(s.Stderr, "%s: removing %s\n", s.ProgName, shortPath(pth))
+			}
+			if err := os.Remove(pth); err != nil {
+				return err
+			}
+			delete(src.Outputs, out)
+		}
+		if len(src.Outputs) == 0 {
+			delete(m.Sources, name)
+		}
+	}
+	if s.DryRun {
+		return nil
+	}
+	return m.write()
+}
+
+//================================================================================
@@ -0,0 +1,112 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/grolang/gro/syntax"
+	"github.com/grolang/gro/syntax/src"
+)
+
+//================================================================================
+// Profiles prints each profile of the language, from the lowest level up, with
+// the permits it adds over the one before and their descriptions. Given Gro
+// files, it instead prints the permits of the profile of each and of those it
+// builds on, marking those disabled by use "blacklist" or taken away by a user
+// profile as disabled. Errors found in a file are reported, and its permits
+// still printed.
+func (s *Session) Profiles(args ...string) {
+	w := tabwriter.NewWriter(s.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	if len(args) == 0 {
+		for i, prof := range syntax.Profiles {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prof.Name, aliasesOf(prof), prof.Desc)
+			for _, pf := range prof.Permits {
+				desc := pf.Desc
+				if pf.Unchecked {
+					desc += " (not yet checked)"
+				}
+				fmt.Fprintf(w, "    %s\t%s\n", pf.Name, desc)
+			}
+		}
+		return
+	}
+
+	for i, filename := range args {
+		text, err := ioutil.ReadFile(filename)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		proj, _ := syntax.ParseProject(filename, src.NewFileBase(filename, filename), text, s.fail, s.GetFile)
+		if proj == nil {
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		var user []syntax.Profile
+		if cfg, err := syntax.FindConfig(filepath.Dir(filename)); err == nil {
+			user = cfg.Profiles
+		}
+		chain := syntax.ProfileChain(proj.Profile, user)
+		if len(chain) == 0 {
+			fmt.Fprintf(w, "%s: no profile %q, so no permits\n", filename, proj.Profile)
+			continue
+		}
+		fmt.Fprintf(w, "%s: profile %s\n", filename, chain[len(chain)-1].Name)
+		listed := map[string]bool{}
+		for _, prof := range chain {
+			for _, pf := range prof.Permits {
+				if listed[pf.Name] {
+					continue // added again by a user profile
+				}
+				listed[pf.Name] = true
+				if proj.Permits[pf.Name] {
+					fmt.Fprintf(w, "    %s\t%s\n", pf.Name, prof.Name)
+				} else {
+					fmt.Fprintf(w, "    %s\t%s, disabled\n", pf.Name, prof.Name)
+				}
+			}
+		}
+		var others []string // enabled by a use declaration rather than the profile
+		for permit, ok := range proj.Permits {
+			if ok && !listed[permit] {
+				others = append(others, permit)
+			}
+		}
+		sort.Strings(others)
+		for _, permit := range others {
+			fmt.Fprintf(w, "    %s\tuse\n", permit)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+// aliasesOf returns the other extensions choosing a profile, in brackets.
+func aliasesOf(prof syntax.Profile) string {
+	if len(prof.Aliases) == 0 {
+		return ""
+	}
+	var names []string
+	for _, alias := range prof.Aliases {
+		if alias == "" {
+			alias = "no extension"
+		}
+		names = append(names, alias)
+	}
+	return " (also " + strings.Join(names, ", ") + ")"
+}
+
+//================================================================================
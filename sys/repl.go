@@ -0,0 +1,731 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/grolang/gro/nodes"
+	"github.com/grolang/gro/syntax"
+	"github.com/grolang/gro/syntax/src"
+)
+
+const (
+	replPrompt = "groo> "
+	replMore   = "....> " // prompt for the rest of an entry with brackets left open
+)
+
+// keywords starting an entry that needn't be preceded by "do" at the top level,
+// with whether the entry is a declaration kept for those after it
+var replKeywords = map[string]bool{
+	"const": true, "type": true, "func": true, "proc": true, "var": false,
+	"if": false, "for": false, "switch": false, "select": false, "go": false,
+}
+
+// A repl holds the declarations entered so far, and the variables bound by the
+// entries run, with their values when last run. Statements are never run again,
+// so they aren't kept.
+type repl struct {
+	decls []string
+	vars  []replBinding
+}
+
+// A replBinding is a variable bound by an entry, declared in Go with the value
+// the entry left it with.
+type replBinding struct {
+	name string
+	decl string            // such as "var a interface{} = int64(3)"
+	pkgs map[string]string // import paths of the packages decl uses, by name
+}
+
+//================================================================================
+// Repl reads groo entries from the standard input, and runs each, printing the
+// value of each expression entered using the String methods of the ops types.
+// An entry continues over several lines while its brackets are left open, and
+// the entry ":quit" stops it.
+//
+// Each entry is prepared along with the declarations entered before it, and
+// the Go program generated is built and run, with a Go file declaring the
+// variables bound so far. After the entry, the program reports the value of
+// each variable, which is kept as Go source for the entries after it, so a
+// statement is only ever run once. A big number is kept as its text. A
+// variable whose value can't be written in Go, such as a pointer, isn't kept.
+// An entry that fails isn't kept. A function call is run as a statement, and
+// any values it returns are discarded. The Timeout applies to each entry.
+func (s *Session) Repl(args ...string) {
+	if len(args) != 0 {
+		fmt.Fprintf(s.Stderr, "%s: usage: gro repl\nToo many arguments given.\n", s.ProgName)
+		s.setExitStatus(2)
+		return
+	}
+	tmp, err := ioutil.TempDir("", "gro-repl")
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	var r repl
+	in := bufio.NewReader(s.Stdin)
+	for {
+		entry, err := readEntry(in, s.Stdout)
+		if entry = strings.TrimSpace(entry); entry == ":quit" || entry == ":q" {
+			return
+		}
+		if entry != "" {
+			s.replEntry(tmp, &r, entry)
+		}
+		if err == io.EOF {
+			fmt.Fprintln(s.Stdout)
+			return
+		} else if err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+// readEntry prompts for an entry, and reads lines until its brackets are closed.
+func readEntry(in *bufio.Reader, out io.Writer) (string, error) {
+	fmt.Fprint(out, replPrompt)
+	var entry string
+	for {
+		line, err := in.ReadString('\n')
+		entry += line
+		if err != nil || bracketDepth(entry) <= 0 {
+			return entry, err
+		}
+		fmt.Fprint(out, replMore)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// bracketDepth returns how many more brackets the text opens than it closes,
+// skipping those in literals and comments.
+func bracketDepth(text string) int {
+	depth := 0
+	var quote rune // the quote of the literal we're in, if any
+	for i := 0; i < len(text); i++ {
+		c := rune(text[i])
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return depth + 1 // the comment is left open, so the entry goes on
+			}
+			i += end + 3
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+//--------------------------------------------------------------------------------
+// replEntry runs an entry after the declarations kept so far, with the variables
+// bound so far, printing what it outputs or the errors found. If it runs
+// successfully, it's kept if it's a declaration, and the variables it leaves
+// are kept.
+func (s *Session) replEntry(tmp string, r *repl, entry string) {
+	isDecl, ok := replKeywords[strings.Fields(entry)[0]]
+	prefixed := !ok && !strings.HasPrefix(entry, "{")
+	if prefixed {
+		entry = "do " + entry
+	}
+	filename := filepath.Join(tmp, "repl.groo")
+
+	// parse the entry by itself, for positions within it in any error found
+	base := src.NewFileBase("repl.groo", "repl.groo")
+	files, err := syntax.ParseBytes(filename, base, []byte(entry), nil, nil, 0, s.GetFile)
+	if err != nil {
+		if se, ok := err.(syntax.Error); ok && prefixed && se.Pos.Line() == 1 && se.Pos.Col() > 3 {
+			se.Pos = src.MakePos(base, 1, se.Pos.Col()-3) // as entered, without the "do "
+			err = se
+		}
+		s.report(err, true)
+		return
+	}
+	isExpr, defined := replStmts(files)
+	declared, vars := replDecls(files)
+	if _, ok := declared["init"]; ok {
+		isDecl = false // as it would run again with every entry after it
+	}
+	text := entry
+	if isExpr {
+		text = fmt.Sprintf("do \"fmt\".Println(%s)", strings.TrimPrefix(entry, "do "))
+	}
+
+	// the variables bound so far are declared in a Go file, except those the
+	// entry declares itself, and all are reported after the entry
+	var bound []replBinding
+	var keep []string
+	for _, v := range r.vars {
+		if _, ok := declared[v.name]; !ok {
+			bound = append(bound, v)
+			keep = append(keep, v.name)
+		}
+	}
+	for _, name := range append(defined, vars...) {
+		if !containsString(keep, name) {
+			keep = append(keep, name)
+		}
+	}
+	outfile := filepath.Join(tmp, "vars.out")
+	args := []string{fmt.Sprintf("%q", outfile)}
+	for _, name := range keep {
+		args = append(args, fmt.Sprintf("%q, &%s", name, name))
+	}
+	text += "\ndo groReplKeep(" + strings.Join(args, ", ") + ")"
+
+	decls := r.decls
+	if isDecl {
+		decls = append(decls, entry)
+	} else {
+		decls = append(decls, text)
+	}
+	if isDecl {
+		decls = append(decls, text[len(entry):]) // so it's still a program
+	}
+	files, err = syntax.ParseBytes(filename, src.NewFileBase(filename, filename), []byte(strings.Join(decls, "\n")+"\n"), nil, nil, 0, s.GetFile)
+	if err != nil {
+		s.report(err, true)
+		return
+	}
+	if len(files) != 1 {
+		fmt.Fprintf(s.Stderr, "%s: only statements, expressions and declarations can be entered\n", s.ProgName)
+		return
+	}
+	gofile := filepath.Join(tmp, "repl.go")
+	for _, f := range files {
+		if err := ioutil.WriteFile(gofile, []byte(syntax.StringWithLinebreaks(f)), 0644); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+	varsfile := filepath.Join(tmp, "vars.go")
+	if err := ioutil.WriteFile(varsfile, replVarsFile(bound), 0644); err != nil {
+		s.fail(err)
+		return
+	}
+	os.Remove(outfile)
+	if !s.replRun(tmp, gofile, varsfile) {
+		return
+	}
+	if isDecl {
+		r.decls = append(r.decls, entry)
+	}
+	r.vars = s.replKept(r.vars, declared, outfile)
+}
+
+//--------------------------------------------------------------------------------
+// replDecls returns the names an entry declares at the top level, other than
+// methods, and those of the variables among them in order.
+func replDecls(files map[string]*nodes.File) (declared map[string]bool, vars []string) {
+	declared = map[string]bool{}
+	for _, f := range files {
+		for _, decl := range f.DeclList {
+			if !decl.Pos().IsKnown() {
+				continue // added for the profile
+			}
+			switch d := decl.(type) {
+			case *nodes.VarDecl:
+				for _, name := range d.NameList {
+					if name.Value != "_" {
+						declared[name.Value] = true
+						vars = append(vars, name.Value)
+					}
+				}
+			case *nodes.ConstDecl:
+				for _, name := range d.NameList {
+					declared[name.Value] = false
+				}
+			case *nodes.TypeDecl:
+				declared[d.Name.Value] = false
+			case *nodes.FuncDecl:
+				if d.Recv == nil {
+					declared[d.Name.Value] = false
+				}
+			}
+		}
+	}
+	return declared, vars
+}
+
+//--------------------------------------------------------------------------------
+// replKept returns the variables kept after an entry runs, given those bound
+// before it and the names it declares, from the values the program reported.
+// A variable whose value can't be declared in Go is dropped, with a note.
+func (s *Session) replKept(vars []replBinding, declared map[string]bool, outfile string) []replBinding {
+	var kept []replBinding
+	for _, v := range vars {
+		if _, ok := declared[v.name]; !ok {
+			kept = append(kept, v)
+		}
+	}
+	data, err := ioutil.ReadFile(outfile)
+	if err != nil {
+		return kept // no variables reported
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 5 {
+			continue
+		}
+		name, typ, value, imports := fields[0], fields[1], fields[2], fields[3]
+		v := replBinding{name: name, decl: fmt.Sprintf("var %s %s = %s", name, typ, value), pkgs: map[string]string{}}
+		ok := fields[4] == "true"
+		for _, imp := range strings.Split(imports, ";") {
+			if i := strings.Index(imp, " "); i > 0 {
+				v.pkgs[imp[:i]] = imp[i+1:]
+				ok = ok && !isInternal(imp[i+1:])
+			}
+		}
+		for _, w := range kept {
+			for pkg, path := range v.pkgs {
+				if p, ok2 := w.pkgs[pkg]; ok2 && p != path && w.name != name {
+					ok = false // two packages of the same name
+				}
+			}
+		}
+		i := 0
+		for i < len(kept) && kept[i].name != name {
+			i++
+		}
+		switch {
+		case !ok:
+			fmt.Fprintf(s.Stderr, "%s: %s is dropped, as its value can't be carried over to later entries\n", s.ProgName, name)
+			if i < len(kept) {
+				kept = append(kept[:i], kept[i+1:]...)
+			}
+		case i < len(kept):
+			kept[i] = v
+		default:
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// isInternal reports whether a package can only be imported by those near it.
+func isInternal(path string) bool {
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "internal" || elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+// replVarsFile returns the Go file declaring the variables bound, along with
+// the functions the program calls to report them.
+func replVarsFile(bound []replBinding) []byte {
+	pkgs := map[string]string{}
+	for _, v := range bound {
+		for pkg, path := range v.pkgs {
+			pkgs[pkg] = path
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString("package main\n\nimport (\n")
+	for _, imp := range []string{"fmt", "math", "math/big", "os", "reflect", "sort", "strconv", "strings"} {
+		fmt.Fprintf(&b, "\tgroRepl%s %q\n", strings.Title(imp[strings.LastIndex(imp, "/")+1:]), imp)
+	}
+	for _, pkg := range sortedKeys(pkgs) {
+		fmt.Fprintf(&b, "\t%s %q\n", pkg, pkgs[pkg])
+	}
+	b.WriteString(")\n\n")
+	for _, v := range bound {
+		b.WriteString(v.decl + "\n")
+	}
+	b.WriteString(replHelpers)
+	return b.Bytes()
+}
+
+//--------------------------------------------------------------------------------
+// replStmts reports whether the statements generated from an entry are for
+// an expression to be printed, and returns the names they define. An
+// expression is one that isn't a call, other than a call generated for one of
+// the dynamic operators or literals.
+func replStmts(files map[string]*nodes.File) (isExpr bool, defined []string) {
+	var stmts []nodes.Stmt // those from the entry, rather than added for the profile
+	for _, f := range files {
+		for _, decl := range f.DeclList {
+			if fd, ok := decl.(*nodes.FuncDecl); ok && fd.Name.Value == "init" && fd.Body != nil {
+				for _, stmt := range fd.Body.List {
+					if stmt.Pos().IsKnown() {
+						stmts = append(stmts, stmt)
+					}
+				}
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		if as, ok := stmt.(*nodes.AssignStmt); ok && as.Op == nodes.Def {
+			lhs := []nodes.Expr{as.Lhs}
+			if list, ok := as.Lhs.(*nodes.ListExpr); ok {
+				lhs = list.ElemList
+			}
+			for _, x := range lhs {
+				if name, ok := x.(*nodes.Name); ok && name.Value != "_" {
+					defined = append(defined, name.Value)
+				}
+			}
+		}
+	}
+	if len(stmts) != 1 {
+		return false, defined
+	}
+	es, ok := stmts[0].(*nodes.ExprStmt)
+	if !ok {
+		return false, defined
+	}
+	call, ok := es.X.(*nodes.CallExpr)
+	if !ok {
+		return true, defined
+	}
+	sel, ok := call.Fun.(*nodes.SelectorExpr)
+	if !ok {
+		return false, defined
+	}
+	pkg, ok := sel.X.(*nodes.Name)
+	return ok && strings.TrimPrefix(pkg.Value, "_") == "groo", defined
+}
+
+// matches the file and position the go command gives with each build error
+var buildErrorPos = regexp.MustCompile(`(?m)^.*(repl|vars)\.go:\d+(:\d+)?: `)
+
+//--------------------------------------------------------------------------------
+// replRun builds and runs the Go files generated for an entry, printing its
+// output, and reports whether it ran successfully.
+func (s *Session) replRun(tmp string, gofiles ...string) bool {
+	prog := filepath.Join(tmp, "repl")
+	if runtime.GOOS == "windows" {
+		prog += ".exe"
+	}
+	var out bytes.Buffer
+	c := exec.Command("go", append([]string{"build", "-o", prog}, gofiles...)...)
+	c.Stdout, c.Stderr = &out, &out
+	if err := c.Run(); err != nil {
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if !strings.HasPrefix(line, "#") {
+				fmt.Fprintf(s.Stderr, "%s: %s\n", s.ProgName, buildErrorPos.ReplaceAllString(line, ""))
+			}
+		}
+		return false
+	}
+
+	out.Reset()
+	c = exec.Command(prog)
+	c.Stdout, c.Stderr = &out, &out
+	timedOut, err := s.runProgram(c)
+	fmt.Fprint(s.Stdout, out.String())
+	switch {
+	case timedOut:
+		fmt.Fprintf(s.Stderr, "%s: entry timed out after %s\n", s.ProgName, s.Timeout)
+	case err != nil:
+		fmt.Fprintf(s.Stderr, "%s: entry failed: %s\n", s.ProgName, err)
+	}
+	return err == nil && !timedOut
+}
+
+// replHelpers is the Go source of the functions the program for an entry calls
+// at its end, with the file to write to, then the name of each variable bound
+// and a pointer to it, to report its value, written as a Go declaration. The
+// value is written as a composite literal of conversions, so it can't contain
+// pointers, functions or channels, other than nil ones, nor fields unexported
+// from other packages. The numbers of math/big, and the ops types defined on
+// them such as BigInt and BigRat, are the exception, being written as their
+// text and parsed back. A line is written to the file for each, giving the
+// name, type and value, the packages they use, and whether it could be written.
+const replHelpers = `
+func groReplKeep(out interface{}, vars ...interface{}) {
+	f, err := groReplOs.Create(groReplFmt.Sprint(out))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	for i := 0; i < len(vars); i += 2 {
+		v := groReplReflect.ValueOf(vars[i+1]).Elem()
+		pkgs := map[string]string{}
+		typ, ok := groReplType(v.Type(), pkgs)
+		lit, ok2 := groReplLit(v, pkgs, 0)
+		var imports []string
+		for pkg, path := range pkgs {
+			imports = append(imports, pkg+" "+path)
+		}
+		groReplSort.Strings(imports)
+		groReplFmt.Fprintf(f, "%s\x00%s\x00%s\x00%s\x00%t\n", groReplFmt.Sprint(vars[i]), typ, lit, groReplStrings.Join(imports, ";"), ok && ok2)
+	}
+}
+
+func groReplType(t groReplReflect.Type, pkgs map[string]string) (string, bool) {
+	if t.Name() != "" {
+		switch path := t.PkgPath(); path {
+		case "", "main":
+			return t.Name(), true
+		case "unsafe":
+			return "", false
+		default:
+			if r := []rune(t.Name())[0]; r < 'A' || r > 'Z' {
+				return "", false
+			}
+			pkg := groReplStrings.SplitN(t.String(), ".", 2)[0]
+			pkgs[pkg] = path
+			return pkg + "." + t.Name(), true
+		}
+	}
+	switch t.Kind() {
+	case groReplReflect.Ptr, groReplReflect.Slice, groReplReflect.Array, groReplReflect.Chan:
+		elem, ok := groReplType(t.Elem(), pkgs)
+		switch t.Kind() {
+		case groReplReflect.Ptr:
+			return "*" + elem, ok
+		case groReplReflect.Slice:
+			return "[]" + elem, ok
+		case groReplReflect.Array:
+			return groReplFmt.Sprintf("[%d]%s", t.Len(), elem), ok
+		}
+		switch t.ChanDir() {
+		case groReplReflect.RecvDir:
+			return "<-chan " + elem, ok
+		case groReplReflect.SendDir:
+			return "chan<- " + elem, ok
+		}
+		if t.Elem().Kind() == groReplReflect.Chan && t.Elem().ChanDir() == groReplReflect.RecvDir {
+			return "chan (" + elem + ")", ok
+		}
+		return "chan " + elem, ok
+	case groReplReflect.Map:
+		key, ok := groReplType(t.Key(), pkgs)
+		elem, ok2 := groReplType(t.Elem(), pkgs)
+		return "map[" + key + "]" + elem, ok && ok2
+	case groReplReflect.Func:
+		sig, ok := groReplSig(t, pkgs)
+		return "func" + sig, ok
+	case groReplReflect.Interface:
+		var methods []string
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			if m.PkgPath != "" && m.PkgPath != "main" {
+				return "", false
+			}
+			sig, ok := groReplSig(m.Type, pkgs)
+			if !ok {
+				return "", false
+			}
+			methods = append(methods, m.Name+sig)
+		}
+		return "interface{" + groReplStrings.Join(methods, "; ") + "}", true
+	case groReplReflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && f.PkgPath != "main" {
+				return "", false
+			}
+			typ, ok := groReplType(f.Type, pkgs)
+			if !ok {
+				return "", false
+			}
+			if !f.Anonymous {
+				typ = f.Name + " " + typ
+			}
+			if f.Tag != "" {
+				typ += " " + groReplStrconv.Quote(string(f.Tag))
+			}
+			fields = append(fields, typ)
+		}
+		return "struct{" + groReplStrings.Join(fields, "; ") + "}", true
+	}
+	return "", false
+}
+
+func groReplSig(t groReplReflect.Type, pkgs map[string]string) (string, bool) {
+	var in, out []string
+	for i := 0; i < t.NumIn(); i++ {
+		typ, ok := groReplType(t.In(i), pkgs)
+		if !ok {
+			return "", false
+		}
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			typ = "..." + typ[2:]
+		}
+		in = append(in, typ)
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		typ, ok := groReplType(t.Out(i), pkgs)
+		if !ok {
+			return "", false
+		}
+		out = append(out, typ)
+	}
+	sig := "(" + groReplStrings.Join(in, ", ") + ")"
+	switch len(out) {
+	case 0:
+		return sig, true
+	case 1:
+		return sig + " " + out[0], true
+	}
+	return sig + " (" + groReplStrings.Join(out, ", ") + ")", true
+}
+
+func groReplLit(v groReplReflect.Value, pkgs map[string]string, depth int) (string, bool) {
+	typ, ok := groReplType(v.Type(), pkgs)
+	if !ok || depth > 100 {
+		return "", false
+	}
+	switch v.Kind() {
+	case groReplReflect.Bool:
+		return typ + "(" + groReplStrconv.FormatBool(v.Bool()) + ")", true
+	case groReplReflect.Int, groReplReflect.Int8, groReplReflect.Int16, groReplReflect.Int32, groReplReflect.Int64:
+		return typ + "(" + groReplStrconv.FormatInt(v.Int(), 10) + ")", true
+	case groReplReflect.Uint, groReplReflect.Uint8, groReplReflect.Uint16, groReplReflect.Uint32, groReplReflect.Uint64, groReplReflect.Uintptr:
+		return typ + "(" + groReplStrconv.FormatUint(v.Uint(), 10) + ")", true
+	case groReplReflect.Float32, groReplReflect.Float64:
+		f, ok := groReplFloat(v.Float(), v.Type().Bits())
+		return typ + "(" + f + ")", ok
+	case groReplReflect.Complex64, groReplReflect.Complex128:
+		c := v.Complex()
+		re, ok := groReplFloat(real(c), v.Type().Bits()/2)
+		im, ok2 := groReplFloat(imag(c), v.Type().Bits()/2)
+		return typ + "(complex(" + re + ", " + im + "))", ok && ok2
+	case groReplReflect.String:
+		return typ + "(" + groReplStrconv.Quote(v.String()) + ")", true
+	case groReplReflect.Interface, groReplReflect.Ptr, groReplReflect.Func, groReplReflect.Chan, groReplReflect.Map, groReplReflect.Slice:
+		switch {
+		case v.IsNil():
+			return "(" + typ + ")(nil)", true
+		case v.Kind() == groReplReflect.Interface:
+			return groReplLit(v.Elem(), pkgs, depth+1)
+		case v.Kind() == groReplReflect.Map:
+			var elems []string
+			for _, k := range v.MapKeys() {
+				key, ok := groReplLit(k, pkgs, depth+1)
+				elem, ok2 := groReplLit(v.MapIndex(k), pkgs, depth+1)
+				if !ok || !ok2 {
+					return "", false
+				}
+				elems = append(elems, key+": "+elem)
+			}
+			groReplSort.Strings(elems)
+			return typ + "{" + groReplStrings.Join(elems, ", ") + "}", true
+		case v.Kind() != groReplReflect.Slice:
+			return "", false
+		}
+		fallthrough
+	case groReplReflect.Array:
+		var elems []string
+		for i := 0; i < v.Len(); i++ {
+			elem, ok := groReplLit(v.Index(i), pkgs, depth+1)
+			if !ok {
+				return "", false
+			}
+			elems = append(elems, elem)
+		}
+		return typ + "{" + groReplStrings.Join(elems, ", ") + "}", true
+	case groReplReflect.Struct:
+		if lit, ok, isBig := groReplBigLit(v, typ); isBig {
+			return lit, ok
+		}
+		var fields []string
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" && f.PkgPath != "main" {
+				return "", false
+			}
+			field, ok := groReplLit(v.Field(i), pkgs, depth+1)
+			if !ok {
+				return "", false
+			}
+			fields = append(fields, f.Name+": "+field)
+		}
+		return typ + "{" + groReplStrings.Join(fields, ", ") + "}", true
+	}
+	return "", false
+}
+
+func groReplBigLit(v groReplReflect.Value, typ string) (lit string, ok, isBig bool) {
+	for _, t := range []groReplReflect.Type{
+		groReplReflect.TypeOf(groReplBig.Int{}),
+		groReplReflect.TypeOf(groReplBig.Rat{}),
+		groReplReflect.TypeOf(groReplBig.Float{}),
+	} {
+		if !v.Type().ConvertibleTo(t) {
+			continue
+		}
+		if !v.CanInterface() {
+			return "", false, true
+		}
+		switch x := v.Convert(t).Interface().(type) {
+		case groReplBig.Int:
+			return typ + "(*groReplBigInt(" + groReplStrconv.Quote(x.String()) + "))", true, true
+		case groReplBig.Rat:
+			return typ + "(*groReplBigRat(" + groReplStrconv.Quote(x.String()) + "))", true, true
+		case groReplBig.Float:
+			return groReplFmt.Sprintf("%s(*groReplBigFloat(%q, %d, %d))", typ, x.Text('p', 0), x.Prec(), int(x.Mode())), true, true
+		}
+	}
+	return "", false, false
+}
+
+func groReplBigInt(s string) *groReplBig.Int {
+	n, _ := new(groReplBig.Int).SetString(s, 10)
+	return n
+}
+
+func groReplBigRat(s string) *groReplBig.Rat {
+	r, _ := new(groReplBig.Rat).SetString(s)
+	return r
+}
+
+func groReplBigFloat(s string, prec uint, mode int) *groReplBig.Float {
+	f, _, _ := new(groReplBig.Float).SetPrec(prec).SetMode(groReplBig.RoundingMode(mode)).Parse(s, 0)
+	return f
+}
+
+func groReplFloat(f float64, bits int) (string, bool) {
+	if groReplMath.IsNaN(f) || groReplMath.IsInf(f, 0) {
+		return "", false
+	}
+	return groReplStrconv.FormatFloat(f, 'g', -1, bits), true
+}
+`
+
+//================================================================================
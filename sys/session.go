@@ -0,0 +1,160 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Options are the settings of a Session.
+type Options struct {
+	Stderr io.Writer // nil means the output is discarded
+	Stdout io.Writer // nil means the output is discarded
+	Stdin  io.Reader // nil means empty input
+
+	ProgName string // prefix of messages, "gro" if empty
+	WantMsgs bool   // print steps as they are executed
+	JSON     bool   // print errors as Diagnostics
+	HTML     bool   // Doc prints an HTML page rather than text
+
+	// directory the Go files are generated into -- if empty, that of each gro file
+	OutDir string
+
+	// name of the gro file Prepare takes the standard input to be -- "stdin.gro" if empty
+	StdinName string
+
+	// instead of writing the Go files, Prepare can print their names, print a diff
+	// against those on disk, or report those on disk that are stale
+	DryRun     bool
+	ShowDiff   bool
+	CheckStale bool
+
+	Parallel int           // number of gro files Prepare parses at the same time -- 0 means 1
+	Force    bool          // prepare gro files even if the manifest says they're up to date
+	Hermetic bool          // Execute prepares and builds in a temporary workspace
+	Keep     bool          // Execute prepares in a workspace, and keeps it afterwards
+	Timeout  time.Duration // how long a program run by Execute or Run may run for -- 0 means no limit
+	RunTests string        // regular expression selecting the tests Test runs -- "" means all
+	Paths    []string      // files and directories for PrepareProject
+}
+
+//--------------------------------------------------------------------------------
+// A Session runs gro commands with its own options and exit status, so that
+// several can run at the same time. The package-level functions each use a
+// new Session with the options in the package-level variables.
+type Session struct {
+	Options
+
+	mu         sync.Mutex
+	exitStatus int
+	diags      []error
+	files      map[string][]byte // if non-nil, records the Go files generated
+	ws         *workspace        // if non-nil, where Go files are built
+}
+
+//--------------------------------------------------------------------------------
+// NewSession returns a Session with the given options.
+func NewSession(opts Options) *Session {
+	if opts.Stderr == nil {
+		opts.Stderr = ioutil.Discard
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = ioutil.Discard
+	}
+	if opts.Stdin == nil {
+		opts.Stdin = strings.NewReader("")
+	}
+	if opts.ProgName == "" {
+		opts.ProgName = "gro"
+	}
+	return &Session{Options: opts}
+}
+
+//--------------------------------------------------------------------------------
+// ExitStatus returns the exit status of the commands run so far in the session.
+func (s *Session) ExitStatus() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exitStatus
+}
+
+//--------------------------------------------------------------------------------
+// Diagnostics returns the errors reported so far in the session.
+func (s *Session) Diagnostics() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.diags...)
+}
+
+//--------------------------------------------------------------------------------
+func (s *Session) setExitStatus(n int) {
+	s.mu.Lock()
+	if s.exitStatus < n {
+		s.exitStatus = n
+	}
+	s.mu.Unlock()
+}
+
+//--------------------------------------------------------------------------------
+// diagnose records an error that has been reported.
+func (s *Session) diagnose(err error) {
+	s.mu.Lock()
+	s.diags = append(s.diags, err)
+	s.mu.Unlock()
+}
+
+//--------------------------------------------------------------------------------
+// fail reports and records an error, setting the exit status to 2.
+func (s *Session) fail(err error) {
+	s.report(err, true)
+	s.diagnose(err)
+	s.setExitStatus(2)
+}
+
+//--------------------------------------------------------------------------------
+// record keeps a generated Go file, if the session is recording them.
+func (s *Session) record(name string, file []byte) {
+	s.mu.Lock()
+	if s.files != nil {
+		s.files[name] = file
+	}
+	s.mu.Unlock()
+}
+
+//================================================================================
+// A Result is the outcome of PrepareProject.
+type Result struct {
+	Files       map[string][]byte // Go files generated, by path
+	Diagnostics []error           // errors found, in the order reported
+	ExitStatus  int               // exit status gro prepare would have
+}
+
+//--------------------------------------------------------------------------------
+// PrepareProject prepares the Gro files at opts.Paths as gro prepare does, and
+// returns the Go files generated along with the errors found, the first of
+// which is also returned. The Go files are written unless the DryRun, ShowDiff
+// or CheckStale option is set, in which case none are skipped as up to date.
+// No package-level variables are used.
+func PrepareProject(opts Options) (Result, error) {
+	if len(opts.Paths) == 0 {
+		return Result{}, errors.New("no paths to prepare")
+	}
+	s := NewSession(opts)
+	s.files = map[string][]byte{}
+	s.Prepare(opts.Paths...)
+	res := Result{Files: s.files, Diagnostics: s.Diagnostics(), ExitStatus: s.ExitStatus()}
+	if len(res.Diagnostics) > 0 {
+		return res, res.Diagnostics[0]
+	}
+	return res, nil
+}
+
+//================================================================================
@@ -0,0 +1,192 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grolang/gro/sys"
+)
+
+//================================================================================
+func TestPrepareProject(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	//several preparations at the same time, with output discarded
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		fn := filepath.Join(tmp, fmt.Sprintf("say%d.gro", i))
+		src := fmt.Sprintf("package main\nfunc main(){\n\t\"fmt\".Println(%d)\n}\n", i)
+		if err := ioutil.WriteFile(fn, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int, fn string) {
+			defer wg.Done()
+			res, err := sys.PrepareProject(sys.Options{Paths: []string{fn}, DryRun: true})
+			gofn := strings.TrimSuffix(fn, ".gro") + ".go"
+			if err != nil || res.ExitStatus != 0 || len(res.Files) != 1 ||
+				!strings.Contains(string(res.Files[gofn]), fmt.Sprintf("fmt.Println(%d)", i)) {
+				t.Errorf("Test %d: wrong result received: %v, %v", i, res, err)
+			}
+			if _, err := os.Stat(gofn); !os.IsNotExist(err) {
+				t.Errorf("Test %d: go file written during dry run", i)
+			}
+		}(i, fn)
+	}
+	wg.Wait()
+
+	//a preparation with an error
+	fn := filepath.Join(tmp, "bad.gro")
+	if err := ioutil.WriteFile(fn, []byte("package main\nfunc main( {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := sys.PrepareProject(sys.Options{Paths: []string{fn}})
+	if err == nil || res.ExitStatus != 2 || len(res.Diagnostics) != 1 || len(res.Files) != 0 {
+		t.Errorf("wrong result received for file with error: %v, %v", res, err)
+	}
+	//errors from several files, reported in the order of their paths
+	var broken []string
+	for _, name := range []string{"b.gro", "a.gro"} {
+		fn := filepath.Join(tmp, "broken", name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte("package main\nfunc main( {\n}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		broken = append(broken, fn)
+	}
+	res, err = sys.PrepareProject(sys.Options{Paths: broken, DryRun: true, Parallel: 2})
+	if len(res.Diagnostics) != 2 || !strings.Contains(res.Diagnostics[0].Error(), "a.gro") ||
+		!strings.Contains(res.Diagnostics[1].Error(), "b.gro") {
+		t.Errorf("wrong errors received for files with errors: %v, %v", res.Diagnostics, err)
+	}
+	if sys.ExitStatus != 0 {
+		t.Errorf("package-level exit status changed to %d", sys.ExitStatus)
+	}
+
+	//two files generating the same go file, prepared in parallel
+	var paths []string
+	for _, dir := range []string{"a", "b"} {
+		fn := filepath.Join(tmp, dir, "dup.gro")
+		os.Mkdir(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte("package main\nfunc main(){}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, fn)
+	}
+	res, err = sys.PrepareProject(sys.Options{Paths: paths, OutDir: filepath.Join(tmp, "out"), DryRun: true, Parallel: 2})
+	if err == nil || !strings.Contains(err.Error(), "both generate") || res.ExitStatus != 2 || len(res.Files) != 1 {
+		t.Errorf("wrong result received for files generating the same go file: %v, %v", res, err)
+	}
+}
+
+//================================================================================
+func TestPreparePattern(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	files := map[string]string{
+		"main.gro":  "include \"lib/*.gro\"\npackage main\nfunc main() {}\n",
+		"lib/a.gro": "package ay\n",
+	}
+	for name, text := range files {
+		pth := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(pth, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fn := filepath.Join(tmp, "main.gro")
+	prepare := func() (sys.Result, string) {
+		var w strings.Builder
+		res, err := sys.PrepareProject(sys.Options{Stderr: &w, WantMsgs: true, Paths: []string{fn}})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return res, w.String()
+	}
+	prepare()
+	if _, msgs := prepare(); !strings.Contains(msgs, "is up to date") {
+		t.Errorf("expected the file to be up to date but received messages: %q", msgs)
+	}
+
+	//a new file matching the pattern makes it stale
+	if err := ioutil.WriteFile(filepath.Join(tmp, "lib", "b.gro"), []byte("package bee\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, msgs := prepare()
+	if strings.Contains(msgs, "is up to date") {
+		t.Errorf("expected the file to be prepared again but received messages: %q", msgs)
+	}
+	found := false
+	for pth := range res.Files {
+		found = found || strings.Contains(pth, "bee")
+	}
+	if !found {
+		t.Errorf("expected a Go file generated for the new file but received %v", res.Files)
+	}
+}
+
+//================================================================================
+func TestPrepareProfile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	files := map[string]string{
+		"cfg/gro.cfg":    "profile g\n",
+		"cfg/config.gro": "package main\nfunc main() {}\n",
+		"used.gro":       "use \"profile\"(\"grog\")\npackage used\nfunc F() {}\n",
+	}
+	for name, text := range files {
+		pth := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(pth, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := []string{filepath.Join(tmp, "cfg", "config.gro"), filepath.Join(tmp, "used.gro")}
+	if _, err := sys.PrepareProject(sys.Options{Paths: paths}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	//the manifest records the profile each is parsed with, rather than its extension or an alias
+	for name, want := range map[string]string{"cfg/config.gro": "g0450", "used.gro": "grog"} {
+		dir, file := filepath.Split(filepath.Join(tmp, filepath.FromSlash(name)))
+		data, err := ioutil.ReadFile(filepath.Join(dir, sys.ManifestName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m struct {
+			Sources map[string]struct{ Profile string }
+		}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Sources[file].Profile; got != want {
+			t.Errorf("%s: expected profile %q recorded but received %q", name, want, got)
+		}
+	}
+}
+
+//================================================================================
@@ -5,18 +5,26 @@
 package sys
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/grolang/gro/syntax"
+	"github.com/grolang/gro/syntax/src"
 )
 
+// The package-level variables are the options of the Session used by the
+// package-level functions, as called by cmd/gro and the generated code.
 var (
 	// default input and output -- can be changed by test suite in gro/cmd/gro
 	Stderr io.Writer = os.Stderr
@@ -25,11 +33,29 @@ var (
 
 	ProgName   = "gro"
 	WantMsgs   bool
+	JSON       bool
+	HTML       bool
 	ExitStatus = 0
+
+	// see Options
+	OutDir     string
+	DryRun     bool
+	ShowDiff   bool
+	CheckStale bool
+	Parallel   int
+	Force      bool
+	Hermetic   bool
+	Keep       bool
+	Timeout    time.Duration
+	RunTests   string
+	StdinName  string
 )
 
 const Suffix = "gro"
 
+// Suffixes are the extensions of the files formatted by Format, one for each profile.
+var Suffixes = []string{"gro", "grog", "groo", "grooy"}
+
 var exitMu sync.Mutex
 
 func setExitStatus(n int) {
@@ -40,191 +66,952 @@ func setExitStatus(n int) {
 	exitMu.Unlock()
 }
 
+//--------------------------------------------------------------------------------
+// withGlobals runs f with a Session using the package-level variables, then
+// updates ExitStatus.
+func withGlobals(f func(*Session)) {
+	s := NewSession(Options{
+		Stderr:     Stderr,
+		Stdout:     Stdout,
+		Stdin:      Stdin,
+		ProgName:   ProgName,
+		WantMsgs:   WantMsgs,
+		JSON:       JSON,
+		HTML:       HTML,
+		OutDir:     OutDir,
+		DryRun:     DryRun,
+		ShowDiff:   ShowDiff,
+		CheckStale: CheckStale,
+		Parallel:   Parallel,
+		Force:      Force,
+		Hermetic:   Hermetic,
+		Keep:       Keep,
+		Timeout:    Timeout,
+		RunTests:   RunTests,
+		StdinName:  StdinName,
+	})
+	f(s)
+	setExitStatus(s.ExitStatus())
+}
+
+func Prepare(args ...string)  { withGlobals(func(s *Session) { s.Prepare(args...) }) }
+func Execute(args ...string)  { withGlobals(func(s *Session) { s.Execute(args...) }) }
+func Run(args ...string)      { withGlobals(func(s *Session) { s.Run(args...) }) }
+func Test(args ...string)     { withGlobals(func(s *Session) { s.Test(args...) }) }
+func Format(args ...string)   { withGlobals(func(s *Session) { s.Format(args...) }) }
+func Check(args ...string)    { withGlobals(func(s *Session) { s.Check(args...) }) }
+func Clean(args ...string)    { withGlobals(func(s *Session) { s.Clean(args...) }) }
+func Doc(args ...string)      { withGlobals(func(s *Session) { s.Doc(args...) }) }
+func Repl(args ...string)     { withGlobals(func(s *Session) { s.Repl(args...) }) }
+func Cache(args ...string)    { withGlobals(func(s *Session) { s.Cache(args...) }) }
+func Profiles(args ...string) { withGlobals(func(s *Session) { s.Profiles(args...) }) }
+
+func GetFile(filename string) (src string, err error) {
+	withGlobals(func(s *Session) { src, err = s.GetFile(filename) })
+	return
+}
+
 //================================================================================
-func Prepare(args ...string) {
+// Prepare generates the Go files from the Gro files at the given paths, walking
+// any directories, and writes them. With no paths, it prepares the standard
+// input instead.
+func (s *Session) Prepare(args ...string) {
 	if len(args) < 1 {
-		fmt.Fprintf(Stderr, "%s: usage: gro prepare path\nNot enough arguments given.\n", ProgName)
-		setExitStatus(2)
+		s.prepareStdin()
 		return
 	}
+	s.prepare(args...)
+}
+
+//--------------------------------------------------------------------------------
+// prepareStdin prepares the Gro source on the standard input as if it were in
+// the file StdinName, and prints the Go files generated to the standard output
+// instead of writing them. If there's more than one, they're printed as a txtar
+// archive, each after a "-- name --" line. The DryRun, ShowDiff and CheckStale
+// options compare them with those on disk as usual.
+func (s *Session) prepareStdin() {
+	filename := s.StdinName
+	if filename == "" {
+		filename = "stdin." + Suffix
+	}
+	pr := s.generate(filename, s.Stdin, nil)
+	s.Stderr.Write(pr.msgs.Bytes())
+	switch {
+	case pr.err != nil:
+		s.fail(pr.err)
+	case s.DryRun || s.ShowDiff || s.CheckStale:
+		if err := s.writeFiles(pr.files); err != nil {
+			s.fail(err)
+		}
+	case len(pr.files) == 1:
+		s.record(pr.files[0].name, pr.files[0].text)
+		s.Stdout.Write(pr.files[0].text)
+	default:
+		for _, g := range pr.files {
+			s.record(g.name, g.text)
+			fmt.Fprintf(s.Stdout, "-- %s --\n", shortPath(g.name))
+			s.Stdout.Write(g.text)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------
+// prepare prepares the Gro files at the given paths, walking any directories,
+// and returns the Go files generated, or found to be up to date, from those
+// without errors.
+func (s *Session) prepare(args ...string) []string {
+	var files []string
 	for i := 0; i < len(args); i++ {
 		pth := args[i]
 		switch dir, err := os.Stat(pth); {
 		case err != nil:
-			fmt.Fprintf(Stderr, "%s: %s\n", ProgName, err)
-			setExitStatus(2)
-			return
+			s.fail(err)
+			return nil
 		case dir.IsDir():
 			filepath.Walk(pth, func(pth string, f os.FileInfo, err error) error {
 				name := f.Name()
 				pth = filepath.ToSlash(pth)
 				if err == nil && !f.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, "."+Suffix) {
-					if WantMsgs {
-						fmt.Fprintf(Stderr, "%s: preparing %s\n", ProgName, pth)
-					}
-					err = processFile(pth, nil, Stdout)
+					files = append(files, pth)
 				}
 				if err != nil {
-					fmt.Fprintf(Stderr, "%s: %s\n", ProgName, err)
-					setExitStatus(2)
+					s.fail(err)
 				}
 				return nil
 			})
 		default:
-			if WantMsgs {
-				fmt.Fprintf(Stderr, "%s: preparing %s\n", ProgName, pth)
+			files = append(files, pth)
+		}
+	}
+	return s.prepareFiles(files)
+}
+
+//--------------------------------------------------------------------------------
+// A prepared holds the Go files generated from a Gro file, before they're written.
+type prepared struct {
+	filename string
+	hash     string
+	includes map[string]string // hashes of the extra files parsed
+	patterns []includePattern  // the include patterns expanded
+	profile  string            // name of the profile it's parsed with
+	upToDate bool              // so not parsed again
+	msgs     bytes.Buffer      // printed before the files are written
+	files    []generated       // in order of name
+	err      error
+}
+
+type generated struct {
+	name     string // where it's written
+	text     []byte
+	included bool // from the packages of a file included
+	shared   bool // generated by an earlier Gro file too, from a file both include, so not written again
+}
+
+//--------------------------------------------------------------------------------
+// prepareFiles generates the Go files from the Gro files, using up to Parallel
+// workers, then writes them, and reports any errors, in the order of the paths
+// of the Gro files. Each Go file may be generated by only one Gro file, unless
+// it's from a file they both include and they generate the same code into it.
+// When writing, Gro files that are up to date according to the manifests are
+// skipped unless Force is set, and the manifests are then updated. It returns
+// the Go files written or skipped.
+func (s *Session) prepareFiles(files []string) (gofiles []string) {
+	sort.Strings(files)
+	uniq := files[:0]
+	for i, f := range files {
+		if i == 0 || f != files[i-1] {
+			uniq = append(uniq, f)
+		}
+	}
+	files = uniq
+
+	writing := !s.DryRun && !s.ShowDiff && !s.CheckStale
+	manifests := map[string]*manifest{}
+	if writing {
+		for _, f := range files {
+			dir := s.outputDir(f)
+			if manifests[dir] != nil {
+				continue
 			}
-			if err := processFile(pth, nil, Stdout); err != nil {
-				fmt.Fprintf(Stderr, "%s: %s\n", ProgName, err)
-				setExitStatus(2)
-				return
+			m, err := readManifest(dir)
+			if err != nil {
+				s.fail(err)
+				return nil
+			}
+			manifests[dir] = m
+		}
+	}
+
+	preps := make([]*prepared, len(files))
+	cache := syntax.NewIncludeCache() // so a file included by several is parsed once
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.Parallel || w == 0; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if m := manifests[s.outputDir(files[i])]; m != nil && !s.Force && m.upToDate(files[i]) {
+					preps[i] = &prepared{filename: files[i], upToDate: true, files: m.outputs(files[i])}
+					if s.WantMsgs {
+						fmt.Fprintf(&preps[i].msgs, "%s: %s is up to date\n", s.ProgName, files[i])
+					}
+					continue
+				}
+				preps[i] = s.generate(files[i], nil, cache)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	genBy := map[string]*prepared{}
+	for _, pr := range preps {
+		for i := range pr.files {
+			g := &pr.files[i]
+			other, ok := genBy[g.name]
+			if !ok || pr.err != nil {
+				continue
+			}
+			first, err := other.output(g.name)
+			if err == nil {
+				var this generated
+				if this, err = pr.output(g.name); err == nil &&
+					!(first.included && this.included && sameCode(first.text, this.text)) {
+					err = fmt.Errorf("%s and %s both generate %s", other.filename, pr.filename, shortPath(g.name))
+				}
+			}
+			if err != nil {
+				pr.err = err
+				continue
+			}
+			g.text, g.shared = first.text, true
+		}
+		if pr.err == nil {
+			for _, g := range pr.files {
+				if !g.shared {
+					genBy[g.name] = pr
+				}
 			}
 		}
 	}
+
+	for _, pr := range preps {
+		s.Stderr.Write(pr.msgs.Bytes())
+		if pr.err == nil && !pr.upToDate {
+			if pr.err = s.writeFiles(pr.files); pr.err == nil && writing {
+				manifests[s.outputDir(pr.filename)].add(pr)
+			}
+		}
+		if pr.err != nil {
+			s.fail(pr.err)
+			continue
+		}
+		for _, g := range pr.files {
+			if !g.shared {
+				gofiles = append(gofiles, g.name)
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(manifests))
+	for dir := range manifests {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if m := manifests[dir]; m.changed {
+			if err := m.write(); err != nil {
+				s.fail(err)
+			}
+		}
+	}
+	return gofiles
 }
 
 //--------------------------------------------------------------------------------
-func GetFile(filename string) (src string, err error) {
-	if WantMsgs {
-		fmt.Fprintf(Stderr, "%s: Parsing extra file %s.\n", ProgName, filename)
+// output returns a Go file generated from the Gro file, with its text, which is
+// on disk if it's up to date. Such a file is taken to be from a file included,
+// as the manifest doesn't say.
+func (pr *prepared) output(name string) (generated, error) {
+	for _, g := range pr.files {
+		if g.name == name && g.text != nil {
+			return g, nil
+		}
 	}
-	f, err := os.Open(filename)
-	if err != nil {
-		return "", err
+	text, err := ioutil.ReadFile(name)
+	return generated{name: name, text: text, included: true}, err
+}
+
+// sameCode reports whether two generated Go files are the same but for the
+// Gro file their header names.
+func sameCode(a, b []byte) bool {
+	if i := bytes.IndexByte(a, '\n'); i >= 0 {
+		a = a[i:]
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[i:]
 	}
-	defer f.Close()
-	s, err := ioutil.ReadAll(f)
-	return string(s), err
+	return bytes.Equal(a, b)
 }
 
 //--------------------------------------------------------------------------------
-// If in == nil, the source is the contents of the file with the given filename.
-// TODO: not called anywhere with non-nil 'in' arg -- needs test
-func processFile(filename string, in io.Reader, out io.Writer) error {
+// outputDir returns the directory the Go files of a Gro file are generated into,
+// which is the OutDir if set, or else that given by the configuration file.
+func (s *Session) outputDir(filename string) string {
+	if s.OutDir != "" {
+		return s.OutDir
+	}
+	if cfg, err := syntax.FindConfig(filepath.Dir(filename)); err == nil && cfg.Output != "" {
+		return filepath.FromSlash(shortPath(cfg.Output))
+	}
+	return filepath.Dir(filename)
+}
+
+//--------------------------------------------------------------------------------
+func (s *Session) GetFile(filename string) (src string, err error) {
+	return s.getFile(s.Stderr)(filename)
+}
+
+// getFile returns a GetFile that prints its messages to msgs.
+func (s *Session) getFile(msgs io.Writer) func(string) (string, error) {
+	return func(filename string) (string, error) {
+		if s.WantMsgs {
+			fmt.Fprintf(msgs, "%s: Parsing extra file %s.\n", s.ProgName, filename)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		text, err := ioutil.ReadAll(f)
+		return string(text), err
+	}
+}
+
+//--------------------------------------------------------------------------------
+// generate parses a Gro file and prints the Go files, without writing them,
+// each with a header saying it's generated. If in == nil, the source is the
+// contents of the file with the given filename. The files it includes are
+// shared with the other Gro files generated with the cache, if it's not nil.
+func (s *Session) generate(filename string, in io.Reader, cache *syntax.IncludeCache) *prepared {
+	pr := &prepared{filename: filename, includes: map[string]string{}}
+	base := src.NewFileBase(filename, filename)
+	if s.WantMsgs {
+		fmt.Fprintf(&pr.msgs, "%s: preparing %s\n", s.ProgName, filename)
+	}
 	if in == nil {
 		f, err := os.Open(filename)
 		if err != nil {
-			return err
+			pr.err = err
+			return pr
 		}
 		defer f.Close()
 		in = f
 	}
 	src, err := ioutil.ReadAll(in)
 	if err != nil {
-		return err
+		pr.err = err
+		return pr
 	}
 
-	asts, err := syntax.ParseBytes(filename, nil, src, nil, nil, 0, GetFile)
+	pr.hash = hashOf(src)
+	asts, inputs, err := syntax.ParseBytesCached(cache, s.OutDir, filename, base, src, nil, nil, 0, s.getFile(&pr.msgs))
+	for name, text := range inputs.Files {
+		pr.includes[name] = hashOf([]byte(text))
+	}
+	pr.profile = inputs.Profile
+	for _, pt := range inputs.Patterns {
+		pr.patterns = append(pr.patterns, includePattern{Dir: pt.Dir, Name: pt.Name, Files: pt.Files})
+	}
 	if err != nil {
-		fmt.Fprintf(Stderr, "%s: Error received: %s\n", ProgName, err)
-		return err
+		if !s.JSON {
+			fmt.Fprintf(&pr.msgs, "%s: Error received: %s\n", s.ProgName, err)
+		}
+		pr.err = err
+		return pr
 	}
-	if len(asts) != 0 && WantMsgs {
-		fmt.Fprintf(Stderr, "%s: Received %d files from ParsePackage.\n", ProgName, len(asts))
+	if len(asts) != 0 && s.WantMsgs {
+		fmt.Fprintf(&pr.msgs, "%s: Received %d files from ParsePackage.\n", s.ProgName, len(asts))
 	}
-	firstGoPath := filepath.SplitList(os.Getenv("GOPATH"))[0]
-	srcPath := filepath.Join(firstGoPath, "src")
-	for name, ast := range asts {
-		file := syntax.StringWithLinebreaks(ast)
-		name = filepath.Join(srcPath, name)
-		err := os.MkdirAll(filepath.Dir(name), os.ModeDir)
+	if cfg, err := syntax.FindConfig(filepath.Dir(filename)); err == nil && cfg.File != "" {
+		for _, name := range append([]string{cfg.File}, cfg.ProfileFiles...) {
+			if text, err := ioutil.ReadFile(name); err == nil {
+				pr.includes[name] = hashOf(text) // so the Gro file is prepared again when it changes
+			}
+		}
+	}
+	root, err := syntax.FindOutputRoot(s.outputDir(filename))
+	if err != nil {
+		pr.err = err
+		return pr
+	}
+	names := make([]string, 0, len(asts))
+	for name := range asts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		text := []byte(fmt.Sprintf("// Code generated by gro from %s; DO NOT EDIT.\n\n%s",
+			filepath.Base(filename), syntax.StringWithLinebreaks(asts[name])))
+		if name, err = root.FilePath(name); err != nil {
+			pr.err = err
+			return pr
+		}
+		included := asts[names[i]].Pos().AbsFilename() != filename
+		pr.files = append(pr.files, generated{name: name, text: text, included: included})
+	}
+	return pr
+}
+
+//--------------------------------------------------------------------------------
+// writeFiles writes the generated Go files, or does what the DryRun, ShowDiff
+// and CheckStale options say instead.
+func (s *Session) writeFiles(files []generated) error {
+	for _, g := range files {
+		if g.shared {
+			continue
+		}
+		s.record(g.name, g.text)
+		if s.DryRun || s.ShowDiff || s.CheckStale {
+			if err := s.compareFile(g.name, g.text); err != nil {
+				return err
+			}
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(g.name), 0755)
 		if err != nil {
-			fmt.Fprintf(Stderr, "%s: Error creating directory: %s\n", ProgName, err)
+			fmt.Fprintf(s.Stderr, "%s: Error creating directory: %s\n", s.ProgName, err)
 			return err
 		}
-		err = ioutil.WriteFile(name, []byte(file), 0644)
+		if err = ioutil.WriteFile(g.name, g.text, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//--------------------------------------------------------------------------------
+// compareFile does what the DryRun, ShowDiff and CheckStale options say to a
+// generated file.
+func (s *Session) compareFile(name string, file []byte) error {
+	shown := shortPath(name)
+	if s.DryRun {
+		fmt.Fprintln(s.Stdout, shown)
+	}
+	if !s.ShowDiff && !s.CheckStale {
+		return nil
 	}
+	old, err := ioutil.ReadFile(name)
+	switch {
+	case err == nil && bytes.Equal(old, file):
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	if s.ShowDiff {
+		s.Stdout.Write(diff(shown, old, file))
+	}
+	if s.CheckStale {
+		fmt.Fprintf(s.Stderr, "%s: %s is stale\n", s.ProgName, shown)
+		s.setExitStatus(1)
+	}
+	return nil
+}
 
-	return err
+//--------------------------------------------------------------------------------
+// shortPath returns a file path for messages, relative to the working directory
+// if the file is within it.
+func shortPath(name string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+	}
+	return filepath.ToSlash(name)
 }
 
 //================================================================================
-func Execute(args ...string) {
-	if len(args) < 1 {
-		fmt.Fprintf(Stderr, "%s: usage: gro execute path\nNot enough arguments given.\n", ProgName)
-		setExitStatus(2)
+// Execute prepares the Gro file given as the first arg, then runs the Go file
+// with the same name as Run does. The program built is cached, and run again
+// without preparing or building while the Gro file, the extra files it parses,
+// and the version of Gro are unchanged, unless the Force option is set. See
+// CacheDir. If the Hermetic or Keep option is set, the Gro file is prepared
+// and built in a temporary workspace instead of beside it.
+func (s *Session) Execute(args ...string) {
+	path, progArgs, ok := s.pathAndArgs("execute", args)
+	if !ok {
 		return
 	}
-	if len(args) > 1 {
-		fmt.Fprintf(Stderr, "%s: usage: gro execute path\nToo many arguments given.\n", ProgName)
-		setExitStatus(2)
+	hermetic := s.Hermetic || s.Keep
+	if hermetic && s.OutDir != "" {
+		fmt.Fprintf(s.Stderr, "%s: a workspace can't be used with an output directory\n", s.ProgName)
+		s.setExitStatus(2)
 		return
 	}
-	Prepare(args...)
-	if ExitStatus > 0 {
+	cache, err := s.cacheDir(path)
+	if err != nil && s.WantMsgs {
+		fmt.Fprintf(s.Stderr, "%s: not caching %s: %s\n", s.ProgName, path, err)
+	}
+	if cache != "" && !s.Force && !s.Keep {
+		if prog, ok := cachedProg(cache); ok {
+			if s.WantMsgs {
+				fmt.Fprintf(s.Stderr, "%s: running cached build of %s\n", s.ProgName, path)
+			}
+			s.runProg(path, prog, progArgs)
+			return
+		}
+	}
+	if hermetic {
+		s.executeInWorkspace(path, cache, progArgs)
+		return
+	}
+
+	s.Prepare(path)
+	if s.ExitStatus() > 0 {
+		return
+	}
+	extLen := len(filepath.Ext(path))
+	outfile := filepath.Join(s.outputDir(path), filepath.Base(path[:len(path)-extLen])+".go")
+	s.buildAndRun(cache, path, outfile, progArgs)
+}
+
+//--------------------------------------------------------------------------------
+// buildAndRun builds and runs the Go file prepared from a Gro file, caching the
+// program built in the cache entry unless it's "".
+func (s *Session) buildAndRun(cache, path, outfile string, progArgs []string) {
+	if cache == "" {
+		s.runGoFile(outfile, progArgs)
+		return
+	}
+	if prog, ok := s.cacheProgram(cache, path, outfile); ok {
+		if s.WantMsgs {
+			fmt.Fprintf(s.Stderr, "%s: running %s\n", s.ProgName, outfile)
+		}
+		s.runProg(outfile, prog, progArgs)
+	}
+}
+
+//================================================================================
+// Run builds and runs a Go file, or the package in a directory, such as one
+// already generated by Prepare, passing it any args following a "--" arg. The
+// exit status of the program becomes that of the session. Terminate signals
+// are passed on to the program, which is stopped if it runs for longer than the
+// Timeout.
+func (s *Session) Run(args ...string) {
+	path, progArgs, ok := s.pathAndArgs("run", args)
+	if !ok {
 		return
 	}
-	extLen := len(filepath.Ext(args[0]))
-	outfile := args[0][:len(args[0])-extLen] + ".go"
-	if WantMsgs {
-		fmt.Fprintf(Stderr, "%s: running %s\n", ProgName, outfile)
+	s.runGoFile(path, progArgs)
+}
+
+//--------------------------------------------------------------------------------
+// pathAndArgs splits the args of the execute or run command into the path and
+// the args after the "--", printing the usage if they're wrong.
+func (s *Session) pathAndArgs(cmd string, args []string) (string, []string, bool) {
+	msg := ""
+	switch {
+	case len(args) < 1:
+		msg = "Not enough arguments given."
+	case len(args) > 1 && args[1] != "--":
+		msg = "Too many arguments given."
+	case len(args) > 1:
+		return args[0], args[2:], true
+	default:
+		return args[0], nil, true
 	}
-	c := exec.Command("go", "run", outfile)
-	c.Stdin = Stdin
-	c.Stdout = Stdout
-	c.Stderr = Stderr
-	err := c.Run()
+	fmt.Fprintf(s.Stderr, "%s: usage: gro %s path [-- arg ...]\n%s\n", s.ProgName, cmd, msg)
+	s.setExitStatus(2)
+	return "", nil, false
+}
+
+//--------------------------------------------------------------------------------
+func (s *Session) runGoFile(outfile string, progArgs []string) {
+	tmp, err := ioutil.TempDir("", "gro-run")
 	if err != nil {
-		fmt.Fprintf(Stderr, "%s: Error: %s executing %s\n", ProgName, err, outfile)
-		setExitStatus(2)
+		s.fail(err)
 		return
 	}
+	defer os.RemoveAll(tmp)
+	prog := progPath(tmp, strings.TrimSuffix(filepath.Base(outfile), ".go"))
+	if !s.buildGoFile(outfile, prog) {
+		return
+	}
+	if s.WantMsgs {
+		fmt.Fprintf(s.Stderr, "%s: running %s\n", s.ProgName, outfile)
+	}
+	s.runProg(outfile, prog, progArgs)
+}
+
+//--------------------------------------------------------------------------------
+// buildGoFile builds a Go file, or the package in a directory, into the program,
+// and reports whether it succeeded. A Go file in the workspace of the session
+// is built there.
+func (s *Session) buildGoFile(outfile, prog string) bool {
+	c := exec.Command("go", "build", "-o", prog, goPath(outfile))
+	if s.ws != nil { // the go command must be run within the module
+		c.Args[len(c.Args)-1] = "." + string(filepath.Separator) + filepath.Base(outfile)
+		c.Dir, c.Env = s.ws.dir, s.ws.env()
+	}
+	c.Stdout = s.Stderr
+	c.Stderr = s.Stderr
+	if err := c.Run(); err != nil {
+		fmt.Fprintf(s.Stderr, "%s: Error: %s building %s\n", s.ProgName, err, outfile)
+		s.setExitStatus(2)
+		return false
+	}
+	return true
+}
+
+//--------------------------------------------------------------------------------
+// runProg runs a program built from the Go file with the given name, setting
+// the exit status of the session to its own.
+func (s *Session) runProg(outfile, prog string, progArgs []string) {
+	c := exec.Command(prog, progArgs...)
+	c.Stdin = s.Stdin
+	c.Stdout = s.Stdout
+	c.Stderr = s.Stderr
+	timedOut, err := s.runProgram(c)
+	s.exited(outfile, "executing", timedOut, err)
+}
+
+//--------------------------------------------------------------------------------
+// exited sets the exit status of the session to that of a program that has
+// finished, reporting why if it didn't exit by itself.
+func (s *Session) exited(name, doing string, timedOut bool, err error) {
+	switch ee, ok := err.(*exec.ExitError); {
+	case timedOut:
+		fmt.Fprintf(s.Stderr, "%s: %s timed out after %s\n", s.ProgName, name, s.Timeout)
+		s.setExitStatus(2)
+	case ok && ee.ExitCode() > 0:
+		if s.WantMsgs {
+			fmt.Fprintf(s.Stderr, "%s: %s exited with status %d\n", s.ProgName, name, ee.ExitCode())
+		}
+		s.setExitStatus(ee.ExitCode())
+	case ok && exitSignal(ee) != 0:
+		sig := exitSignal(ee)
+		if s.WantMsgs {
+			fmt.Fprintf(s.Stderr, "%s: %s was stopped by signal: %s\n", s.ProgName, name, sig)
+		}
+		s.setExitStatus(128 + int(sig)) // as a shell gives it
+	case err != nil:
+		fmt.Fprintf(s.Stderr, "%s: Error: %s %s %s\n", s.ProgName, err, doing, name)
+		s.setExitStatus(2)
+	}
+}
+
+// exitSignal returns the signal that stopped a program, or 0 if none did.
+func exitSignal(ee *exec.ExitError) syscall.Signal {
+	if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal()
+	}
+	return 0
+}
+
+//--------------------------------------------------------------------------------
+// goPath returns a file or directory path as the go command takes it, which
+// is relative to the working directory and starting with a dot if possible.
+func goPath(name string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if abs, err := filepath.Abs(name); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil {
+				name = rel
+			}
+		}
+	}
+	if !filepath.IsAbs(name) && !strings.HasPrefix(name, ".") {
+		name = "." + string(filepath.Separator) + name
+	}
+	return name
+}
+
+// killDelay is how long a program is given to stop after being interrupted
+// for running too long, before it's killed.
+const killDelay = 5 * time.Second
+
+//--------------------------------------------------------------------------------
+// runProgram starts the command and waits for it to finish, passing on any
+// terminate signal received meanwhile. An interrupt isn't passed on, as the
+// terminal sends it to the program as well as to gro, which ignores it. If the
+// program runs for longer than the Timeout, it's interrupted, or killed if
+// that's not possible or it doesn't stop within the killDelay, and timedOut is
+// returned true.
+func (s *Session) runProgram(c *exec.Cmd) (timedOut bool, err error) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	if err := c.Start(); err != nil {
+		return false, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+
+	var timeout, kill <-chan time.Time
+	if s.Timeout > 0 {
+		t := time.NewTimer(s.Timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		select {
+		case err := <-done:
+			return timedOut, err
+		case sig := <-sigs:
+			if sig == os.Interrupt {
+				continue // the program has it already
+			}
+			if c.Process.Signal(sig) != nil {
+				c.Process.Kill()
+			}
+		case <-timeout:
+			timedOut = true
+			if c.Process.Signal(os.Interrupt) != nil {
+				c.Process.Kill()
+			}
+			t := time.NewTimer(killDelay)
+			defer t.Stop()
+			kill = t.C
+		case <-kill:
+			c.Process.Kill()
+		}
+	}
 }
 
 //================================================================================
-func Run(args ...string) {
+// Test prepares the Gro files at the given paths as Prepare does, then runs go
+// test on each package a testcode section was prepared into. Any path that is
+// neither a Gro file nor a directory holding them, such as a Go package, is
+// passed to go test as it is. The RunTests option is passed on to go test as
+// the -run flag, and WantMsgs as the -v flag. The exit status of go test
+// becomes that of the session.
+func (s *Session) Test(args ...string) {
 	if len(args) < 1 {
-		fmt.Fprintf(Stderr, "%s: usage: go run path\nNot enough arguments given.\n", ProgName)
-		setExitStatus(2)
+		fmt.Fprintf(s.Stderr, "%s: usage: gro test path ...\nNot enough arguments given.\n", s.ProgName)
+		s.setExitStatus(2)
 		return
 	}
-	if len(args) > 1 {
-		fmt.Fprintf(Stderr, "%s: usage: go run path\nToo many arguments given.\n", ProgName)
-		setExitStatus(2)
-		return
+	var groPaths, pkgs []string
+	for _, pth := range args {
+		if strings.HasSuffix(pth, "."+Suffix) || hasGroFiles(pth) {
+			groPaths = append(groPaths, pth)
+		} else {
+			pkgs = append(pkgs, pth)
+		}
 	}
-	outfile := args[0]
-	if WantMsgs {
-		fmt.Fprintf(Stderr, "%s: running %s\n", ProgName, outfile)
+	if len(groPaths) > 0 {
+		gofiles := s.prepare(groPaths...)
+		if s.ExitStatus() > 0 {
+			return
+		}
+		seen := map[string]bool{}
+		for _, f := range gofiles {
+			if dir := goPath(filepath.Dir(f)); strings.HasSuffix(f, "_test.go") && !seen[dir] {
+				seen[dir] = true
+				pkgs = append(pkgs, dir)
+			}
+		}
 	}
-	c := exec.Command("go", "run", outfile)
-	c.Stdin = Stdin
-	c.Stdout = Stdout
-	c.Stderr = Stderr
-	err := c.Run()
-	if err != nil {
-		fmt.Fprintf(Stderr, "%s: Error: %s running %s\n", ProgName, err, outfile)
-		setExitStatus(2)
+	if len(pkgs) == 0 {
+		fmt.Fprintf(s.Stderr, "%s: no testcode sections found\n", s.ProgName)
 		return
 	}
+
+	testArgs := []string{"test"}
+	if s.WantMsgs {
+		testArgs = append(testArgs, "-v")
+	}
+	if s.RunTests != "" {
+		testArgs = append(testArgs, "-run", s.RunTests)
+	}
+	testArgs = append(testArgs, pkgs...)
+	if s.WantMsgs {
+		fmt.Fprintf(s.Stderr, "%s: testing %s\n", s.ProgName, strings.Join(pkgs, " "))
+	}
+	c := exec.Command("go", testArgs...)
+	c.Stdin = s.Stdin
+	c.Stdout = s.Stdout
+	c.Stderr = s.Stderr
+	timedOut, err := s.runProgram(c)
+	s.exited(strings.Join(pkgs, " "), "testing", timedOut, err)
+}
+
+//--------------------------------------------------------------------------------
+// hasGroFiles reports whether pth is a directory holding Gro files that
+// Prepare would prepare.
+func hasGroFiles(pth string) bool {
+	found := false
+	filepath.Walk(pth, func(pth string, f os.FileInfo, err error) error {
+		if err == nil && !f.IsDir() && !strings.HasPrefix(f.Name(), ".") && strings.HasSuffix(f.Name(), "."+Suffix) {
+			found = true
+			return io.EOF // stop walking
+		}
+		return nil
+	})
+	return found
 }
 
 //================================================================================
-func Test(args ...string) {
+// Format formats the Gro files at the given paths in place, walking any
+// directories for files with one of the Suffixes. With no paths, it formats
+// standard input to standard output.
+func (s *Session) Format(args ...string) {
 	if len(args) < 1 {
-		fmt.Fprintf(Stderr, "%s: usage: go test path\nNot enough arguments given.\n", ProgName)
-		setExitStatus(2)
+		if err := s.formatFile("<standard input>", s.Stdin, s.Stdout); err != nil {
+			s.fail(err)
+		}
 		return
 	}
-	if len(args) > 1 {
-		fmt.Fprintf(Stderr, "%s: usage: go test path\nToo many arguments given.\n", ProgName)
-		setExitStatus(2)
-		return
+	for i := 0; i < len(args); i++ {
+		pth := args[i]
+		switch dir, err := os.Stat(pth); {
+		case err != nil:
+			s.fail(err)
+			return
+		case dir.IsDir():
+			filepath.Walk(pth, func(pth string, f os.FileInfo, err error) error {
+				name := f.Name()
+				pth = filepath.ToSlash(pth)
+				if err == nil && !f.IsDir() && !strings.HasPrefix(name, ".") && isGroFile(name) {
+					if s.WantMsgs {
+						fmt.Fprintf(s.Stderr, "%s: formatting %s\n", s.ProgName, pth)
+					}
+					err = s.formatFile(pth, nil, nil)
+				}
+				if err != nil {
+					s.fail(err)
+				}
+				return nil
+			})
+		default:
+			if s.WantMsgs {
+				fmt.Fprintf(s.Stderr, "%s: formatting %s\n", s.ProgName, pth)
+			}
+			if err := s.formatFile(pth, nil, nil); err != nil {
+				s.fail(err)
+				return
+			}
+		}
 	}
-	outfile := args[0]
-	if WantMsgs {
-		fmt.Fprintf(Stderr, "%s: running %s\n", ProgName, outfile)
+}
+
+//--------------------------------------------------------------------------------
+func isGroFile(name string) bool {
+	for _, sfx := range Suffixes {
+		if strings.HasSuffix(name, "."+sfx) {
+			return true
+		}
+	}
+	return false
+}
+
+//--------------------------------------------------------------------------------
+// If in == nil, the source is the contents of the file with the given filename,
+// which is rewritten only if formatting changes it. Otherwise the formatted
+// source is written to out.
+func (s *Session) formatFile(filename string, in io.Reader, out io.Writer) error {
+	var src []byte
+	var err error
+	if in == nil {
+		src, err = ioutil.ReadFile(filename)
+	} else {
+		src, err = ioutil.ReadAll(in)
 	}
-	c := exec.Command("go", "test", outfile)
-	c.Stdin = Stdin
-	c.Stdout = Stdout
-	c.Stderr = Stderr
-	err := c.Run()
 	if err != nil {
-		fmt.Fprintf(Stderr, "%s: Error: %s testing %s\n", ProgName, err, outfile)
-		setExitStatus(2)
-		return
+		return err
+	}
+
+	res, err := syntax.Format(filename, src)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		_, err = out.Write(res)
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, res, fi.Mode().Perm())
+}
+
+//================================================================================
+// Check parses the Gro files at the given paths, walking any directories for
+// files with one of the Suffixes, and reports every syntax and permit error
+// found. It writes no files. With no paths, it checks the current directory.
+func (s *Session) Check(args ...string) {
+	if len(args) < 1 {
+		args = []string{"."}
+	}
+	errs := 0
+	for i := 0; i < len(args); i++ {
+		pth := args[i]
+		switch dir, err := os.Stat(pth); {
+		case err != nil:
+			s.fail(err)
+			return
+		case dir.IsDir():
+			filepath.Walk(pth, func(pth string, f os.FileInfo, err error) error {
+				name := f.Name()
+				pth = filepath.ToSlash(pth)
+				if err == nil && !f.IsDir() && !strings.HasPrefix(name, ".") && isGroFile(name) {
+					if s.WantMsgs {
+						fmt.Fprintf(s.Stderr, "%s: checking %s\n", s.ProgName, pth)
+					}
+					var n int
+					n, err = s.checkFile(pth)
+					errs += n
+				}
+				if err != nil {
+					s.fail(err)
+				}
+				return nil
+			})
+		default:
+			if s.WantMsgs {
+				fmt.Fprintf(s.Stderr, "%s: checking %s\n", s.ProgName, pth)
+			}
+			n, err := s.checkFile(pth)
+			errs += n
+			if err != nil {
+				s.fail(err)
+			}
+		}
+	}
+	if errs > 0 {
+		if !s.JSON {
+			fmt.Fprintf(s.Stderr, "%s: %d error(s) found\n", s.ProgName, errs)
+		}
+		s.setExitStatus(1)
+	}
+}
+
+//--------------------------------------------------------------------------------
+// checkFile parses the given file, printing each error found, and returns how
+// many there were. The returned error is for when the file can't be read.
+func (s *Session) checkFile(filename string) (int, error) {
+	text, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	errh := func(err error) {
+		s.report(err, false)
+		s.diagnose(err)
+		n++
+	}
+	_, err = syntax.ParseBytes(filename, src.NewFileBase(filename, filename), text, errh, nil, 0, s.GetFile)
+	if err != nil && n == 0 { // not passed to errh
+		errh(err)
 	}
+	return n, nil
 }
 
 //================================================================================
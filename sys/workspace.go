@@ -0,0 +1,115 @@
+// Copyright 2017 The Gro Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sys
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// workspaceModule is the module path of the Go files generated into a
+// workspace, and so the start of the import paths of their packages.
+const workspaceModule = "workspace"
+
+//================================================================================
+// A workspace is a temporary directory a Gro file is prepared and built in,
+// rather than beside it, so the source tree is left untouched. The Go files are
+// generated into the module directory, which holds a go.mod, and lies where
+// its module path says within the src directory of the workspace, so the
+// packages generated import each other whether the go command uses modules or
+// the GOPATH.
+type workspace struct {
+	root string // the temporary directory, a GOPATH entry
+	dir  string // the module directory
+}
+
+//--------------------------------------------------------------------------------
+// newWorkspace creates a workspace, with a go.mod declaring the module path
+// and the version of Go gro is built with.
+func newWorkspace() (*workspace, error) {
+	root, err := ioutil.TempDir("", "gro-workspace")
+	if err != nil {
+		return nil, err
+	}
+	ws := &workspace{root: root, dir: filepath.Join(root, "src", workspaceModule)}
+	mod := fmt.Sprintf("module %s\n", workspaceModule)
+	if v := goDirective(runtime.Version()); v != "" {
+		mod += fmt.Sprintf("\ngo %s\n", v)
+	}
+	if err := os.MkdirAll(ws.dir, 0755); err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(ws.dir, "go.mod"), []byte(mod), 0644); err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+	return ws, nil
+}
+
+//--------------------------------------------------------------------------------
+// goDirective returns the language version for the go directive of a go.mod,
+// such as 1.21 for the Go version go1.21.3, or "" for a development version.
+func goDirective(version string) string {
+	if !strings.HasPrefix(version, "go1.") {
+		return ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(version, "go"), ".", 3)
+	minor := parts[1]
+	if i := strings.IndexAny(minor, "abcdefghijklmnopqrstuvwxyz "); i >= 0 {
+		minor = minor[:i] // such as go1.21rc2
+	}
+	return parts[0] + "." + minor
+}
+
+//--------------------------------------------------------------------------------
+// env returns the environment the go command builds in the workspace with.
+// The workspace is the last GOPATH entry, so any modules needed are still
+// downloaded into the first, and the requirements of the module are added as
+// the packages generated need them.
+func (ws *workspace) env() []string {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		gopath = build.Default.GOPATH
+	}
+	flags := strings.TrimSpace(os.Getenv("GOFLAGS") + " -mod=mod")
+	return append(os.Environ(),
+		"GOPATH="+gopath+string(filepath.ListSeparator)+ws.root,
+		"GOFLAGS="+flags)
+}
+
+//--------------------------------------------------------------------------------
+// executeInWorkspace prepares the Gro file into a new workspace, then builds
+// and runs the Go file generated from it as Execute does, removing the
+// workspace afterwards unless the Keep option is set.
+func (s *Session) executeInWorkspace(path, cache string, progArgs []string) {
+	ws, err := newWorkspace()
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	if s.Keep {
+		defer fmt.Fprintf(s.Stderr, "%s: keeping workspace %s\n", s.ProgName, ws.dir)
+	} else {
+		defer os.RemoveAll(ws.root)
+	}
+	s.OutDir, s.ws = ws.dir, ws
+	defer func() { s.OutDir, s.ws = "", nil }()
+
+	s.Prepare(path)
+	if s.ExitStatus() > 0 {
+		return
+	}
+	extLen := len(filepath.Ext(path))
+	outfile := filepath.Join(ws.dir, filepath.Base(path[:len(path)-extLen])+".go")
+	s.buildAndRun(cache, path, outfile, progArgs)
+}
+
+//================================================================================